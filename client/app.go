@@ -6,13 +6,12 @@ import (
 	"caffeine/core"
 	"context"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
-	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -30,15 +29,21 @@ type ClientApp struct {
 	shellManager    *WebShellManger
 	terminalManager *TerminalManager
 	taskManger      *webshell.TaskManager
+	profiles        *c2.ProfileLibrary // C2配置库
 }
 
 // 导出方法，ui调用
 func GetClientApp() *ClientApp {
 	once.Do(func() {
+		profiles, err := c2.NewProfileLibrary(core.GetInstance().ProfileDir, c2.GetKeyStore())
+		if err != nil {
+			for name, loadErr := range profiles.Errors() {
+				core.GetLogger().Errorf("加载C2配置 %s 失败: %v", name, loadErr)
+			}
+		}
 		appCli := ClientApp{
-			shellManager: &WebShellManger{
-				clients: make(map[int64]*webshell.WebClient),
-			},
+			shellManager: NewWebShellManager(nil, profiles),
+			profiles:     profiles,
 			terminalManager: &TerminalManager{
 				terminals: make(map[int64]*webshell.Terminal),
 			},
@@ -52,19 +57,22 @@ func GetClientApp() *ClientApp {
 
 func GetWebClient(sessionID int64) *webshell.WebClient {
 	app := GetClientApp()
-	return app.shellManager.clients[sessionID]
+	return app.shellManager.GetClient(sessionID)
 }
 
 func (a *ClientApp) startup(ctx context.Context) {
 	a.ctx = ctx
+	if err := core.GetMetricsExporter().Update(core.GetInstance().Metrics.Listen); err != nil {
+		core.GetLogger().Warnf("启动指标导出失败: %v", err)
+	}
 }
 
 // 获取shell列表
 func (a *ClientApp) GetShellList(mode int) []ShellEntry {
 	if mode == 0 {
 		//本地模式
-		return []ShellEntry{
-			ShellEntry{
+		entries := []ShellEntry{
+			{
 				ID:         0,
 				URL:        "http://127.0.0.1/shell.jsp",
 				IP:         "127.0.0.1",
@@ -74,7 +82,7 @@ func (a *ClientApp) GetShellList(mode int) []ShellEntry {
 				UpdateTime: time.Now().Format("2006-01-02"),
 				ShellType:  "java",
 			},
-			ShellEntry{
+			{
 				ID:         1,
 				URL:        "http://127.0.0.1:7878/shell.php",
 				IP:         "127.0.0.1",
@@ -85,47 +93,109 @@ func (a *ClientApp) GetShellList(mode int) []ShellEntry {
 				ShellType:  "php",
 			},
 		}
+		for i := range entries {
+			a.shellManager.storeEntry(&entries[i])
+		}
+		return entries
 	}
 	return []ShellEntry{}
 }
 
-// 进入shell
-func (a *ClientApp) GetShellID() int64 {
-	//TODO 省略前面数据库操作和新建步骤
-	data, err := ioutil.ReadFile("D:\\code\\project\\caffeine\\c2.yaml")
-	if err != nil {
-		fmt.Errorf("无法读取文件: %v", err)
+// 进入shell，使用shell绑定的C2配置创建客户端
+func (a *ClientApp) GetShellID(shellID int64) (int64, error) {
+	entry := a.shellManager.GetEntry(shellID)
+	if entry == nil {
+		return 0, fmt.Errorf("shell not found: %d", shellID)
+	}
+	if client := a.shellManager.GetClient(shellID); client != nil {
+		return client.ID, nil
 	}
-	//设置代理
-	//core.BasicCfg.ProxyURL = "http://127.0.0.1:8083"
-	var conf c2.C2Yaml
-	err = yaml.Unmarshal(data, &conf)
+	client, err := entry.ToWebClient(a.profiles)
 	if err != nil {
-		fmt.Errorf("无法解析 YAML 文件: %v", err)
+		return 0, err
 	}
-
-	target := core.Target{ShellURL: "http://127.0.0.1/shell/server.php"}
-	client := webshell.NewWebClient(target, conf)
 	a.shellManager.AddWebShell(client)
-	return client.ID
+	return client.ID, nil
+}
+
+// ListProfiles 返回配置库中可用的C2配置及其使用的密钥
+func (a *ClientApp) ListProfiles() []c2.ProfileInfo {
+	return a.profiles.List()
+}
+
+// ReloadProfiles 重新加载C2配置目录，已连接的shell不受影响
+func (a *ClientApp) ReloadProfiles() error {
+	return a.profiles.Load()
+}
+
+// GetProfileSchema C2配置的JSON Schema，用于前端编辑时校验
+func (a *ClientApp) GetProfileSchema() (string, error) {
+	data, err := c2.ProfileSchema().JSON()
+	return string(data), err
+}
+
+// GetSettingsSchema 基础配置的JSON Schema
+func (a *ClientApp) GetSettingsSchema() (string, error) {
+	data, err := core.BasicConfigSchema().JSON()
+	return string(data), err
+}
+
+// GetHttpMetrics 按目标与 hook 方法统计的请求数、错误数、耗时分布与传输字节数
+func (a *ClientApp) GetHttpMetrics() core.MetricsSnapshot {
+	return core.GetHttpEngine().Metrics()
+}
+
+// GetMetricsAddr Prometheus 指标的导出地址，未导出时为空
+func (a *ClientApp) GetMetricsAddr() string {
+	return core.GetMetricsExporter().Addr()
+}
+
+// GetProxyStats 代理池中各代理的状态与统计
+func (a *ClientApp) GetProxyStats() []core.ProxyStats {
+	return core.GetProxyPool().Stats()
+}
+
+// CheckProxies 立即探测代理池中的全部代理
+func (a *ClientApp) CheckProxies() []core.ProxyStats {
+	pool := core.GetProxyPool()
+	pool.CheckAll()
+	return pool.Stats()
 }
 
 // 测试连接
 func (a *ClientApp) TestConnect(id int64) bool {
-	client := a.shellManager.clients[id]
-	return client.CheckConnect()
+	client := a.shellManager.GetClient(id)
+	// 手动测试时不受熔断影响，直接探测目标
+	core.GetHttpEngine().Breaker().Reset(core.ShellKey(id))
+	online := client.CheckConnect()
+	if online {
+		a.shellManager.SetEntryStatus(id, 1)
+	} else {
+		a.shellManager.SetEntryStatus(id, 0)
+	}
+	return online
+}
+
+// GetAliveShells 返回在线shell的ID
+func (a *ClientApp) GetAliveShells() []int64 {
+	return a.shellManager.AliveShells()
+}
+
+// CheckAllShells 批量检测全部shell是否在线，检测请求按基础配置分散执行
+func (a *ClientApp) CheckAllShells() map[int64]bool {
+	return a.shellManager.CheckAll(a.ctx)
 }
 
 // 初始化shell,输出系统信息
 func (a *ClientApp) InitShell(id int64) *core.SystemInfo {
-	client := a.shellManager.clients[id]
+	client := a.shellManager.GetClient(id)
 	client.GetSystemInfo()
 	//	client.LoadDir(client.GetSession().GetCurrentDir())
 	return client.GetSession().Info
 }
 
 func (a *ClientApp) Exec(id int64, path, cmd string) string {
-	client := a.shellManager.clients[id]
+	client := a.shellManager.GetClient(id)
 	runCMD := client.RunCMD(path, cmd)
 	return runCMD
 }
@@ -153,7 +223,7 @@ func (a *ClientApp) GetLocalSystemMetrics() (*SystemMetric, error) {
 
 // CreateTerminal 创建新终端
 func (a *ClientApp) CreateTerminal(shellID int64) (*webshell.TerminalInfo, error) {
-	client := a.shellManager.clients[shellID]
+	client := a.shellManager.GetClient(shellID)
 	if client == nil {
 		return nil, fmt.Errorf("shell client not found: %d", shellID)
 	}
@@ -221,6 +291,7 @@ func (a *ClientApp) CloseTerminal(terminalID int64) error {
 		return fmt.Errorf("terminal not found: %d", terminalID)
 	}
 
+	terminal.Close()
 	delete(a.terminalManager.terminals, terminalID)
 	return nil
 }
@@ -268,7 +339,7 @@ func (a *ClientApp) AddNewShell(data map[string]interface{}) (int64, error) {
 }
 
 func (a *ClientApp) GetFileSystem(shellID int64) core.FileSystemCache {
-	client := a.shellManager.clients[shellID]
+	client := a.shellManager.GetClient(shellID)
 	return *client.GetFileSystem()
 }
 
@@ -291,7 +362,7 @@ func (a *ClientApp) LoadDirInfo(shellID int64, path string) core.Directory {
 
 // 获取操作的实例
 func (a *ClientApp) getWebshellClient(shellID int64) *webshell.WebClient {
-	return a.shellManager.clients[shellID]
+	return a.shellManager.GetClient(shellID)
 }
 
 // 下载文件,根据文件大小选择方式
@@ -317,3 +388,43 @@ func (a *ClientApp) DownloadFile(shellID int64, targetPath string, savePath stri
 	//}
 	return task.ID
 }
+
+// CancelTask 取消任务，中止正在进行的传输
+func (a *ClientApp) CancelTask(taskID string) error {
+	return a.taskManger.CancelTask(taskID)
+}
+
+// ExportHAR 将符合条件的流量导出为HAR文件，返回导出的条目数
+func (a *ClientApp) ExportHAR(path string, opts core.HarOptions) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return core.GetCacheManager().WriteHAR(file, opts)
+}
+
+// QueryTraffic 按会话、shell、操作、时间与状态码查询缓存的流量
+func (a *ClientApp) QueryTraffic(query core.TrafficQuery) (*core.TrafficPage, error) {
+	return core.GetCacheManager().QueryTraffic(query)
+}
+
+// GetTraffic 获取一次请求的原始报文与明文
+func (a *ClientApp) GetTraffic(id int64) (*core.TrafficRecord, error) {
+	return core.GetCacheManager().GetTraffic(id)
+}
+
+// PruneTrafficCache 立即按保留策略清理流量缓存
+func (a *ClientApp) PruneTrafficCache() (core.PruneResult, error) {
+	return core.GetCacheManager().Prune(core.GetInstance().TrafficCache)
+}
+
+// ImportHAR 将HAR文件导入流量缓存，返回导入的条目数
+func (a *ClientApp) ImportHAR(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return core.GetCacheManager().ImportHAR(file)
+}
@@ -0,0 +1,218 @@
+package c2
+
+import (
+	"caffeine/core"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeyKind 编解码器依赖的密钥类型
+type KeyKind string
+
+const (
+	KeyAES        KeyKind = "aes"
+	KeyXor        KeyKind = "xor"
+	KeyRSAPublic  KeyKind = "rsa_public"
+	KeyRSAPrivate KeyKind = "rsa_private"
+)
+
+// 加密链中各步骤的分隔符
+const chainSeparator = "->"
+
+// Codec 加密链中的一个编解码步骤
+// 请求方向调用 Encode，响应方向调用 Decode
+type Codec interface {
+	Name() string
+	Encode(data []byte, key *CipherKey) ([]byte, error)
+	Decode(data []byte, key *CipherKey) ([]byte, error)
+	RequiredKeys() []KeyKind // 编解码所需的密钥
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[string]Codec)
+)
+
+// RegisterCodec 注册编解码器，名称重复时返回错误
+func RegisterCodec(codec Codec) error {
+	name := codec.Name()
+	if name == "" || strings.Contains(name, chainSeparator) {
+		return fmt.Errorf("无效的编解码器名称: %q", name)
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if _, exists := codecs[name]; exists {
+		return fmt.Errorf("编解码器 %s 已注册", name)
+	}
+	codecs[name] = codec
+	return nil
+}
+
+// MustRegisterCodec 注册编解码器，失败时panic，便于在init中使用
+func MustRegisterCodec(codec Codec) {
+	if err := RegisterCodec(codec); err != nil {
+		panic(err)
+	}
+}
+
+// GetCodec 根据名称获取编解码器
+func GetCodec(name string) (Codec, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// CodecNames 返回所有已注册的编解码器名称(已排序)
+func CodecNames() []string {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseCodecChain 解析形如 hex->base64 的加密链
+func ParseCodecChain(expr string) ([]Codec, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	split := strings.Split(expr, chainSeparator)
+	chain := make([]Codec, 0, len(split))
+	for _, name := range split {
+		name = strings.TrimSpace(name)
+		codec, ok := GetCodec(name)
+		if !ok {
+			return nil, fmt.Errorf("未注册的编解码器: %s", name)
+		}
+		chain = append(chain, codec)
+	}
+	return chain, nil
+}
+
+// 内置编解码器
+type funcCodec struct {
+	name     string
+	keys     []KeyKind
+	alphabet string // 输出字符集，二进制输出为空
+	encode   func(data []byte, key *CipherKey) ([]byte, error)
+	decode   func(data []byte, key *CipherKey) ([]byte, error)
+}
+
+func (c *funcCodec) Name() string { return c.name }
+
+func (c *funcCodec) Encode(data []byte, key *CipherKey) ([]byte, error) {
+	return c.encode(data, key)
+}
+
+func (c *funcCodec) Decode(data []byte, key *CipherKey) ([]byte, error) {
+	return c.decode(data, key)
+}
+
+func (c *funcCodec) RequiredKeys() []KeyKind { return c.keys }
+
+func (c *funcCodec) Alphabet() string { return c.alphabet }
+
+func init() {
+	MustRegisterCodec(&funcCodec{
+		name:     string(core.Base64),
+		alphabet: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=",
+		encode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return core.Base64Encode(data), nil
+		},
+		decode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return core.Base64Decode(data)
+		},
+	})
+	MustRegisterCodec(&funcCodec{
+		name:     string(core.Hex),
+		alphabet: "0123456789abcdef",
+		encode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return core.ToHex(data), nil
+		},
+		decode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return core.UnHex(data)
+		},
+	})
+	MustRegisterCodec(&funcCodec{
+		name: string(core.Xor),
+		keys: []KeyKind{KeyXor},
+		encode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return xorCrypto(data, key)
+		},
+		decode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return xorCrypto(data, key)
+		},
+	})
+	MustRegisterCodec(&funcCodec{
+		name: string(core.AES),
+		keys: []KeyKind{KeyAES},
+		encode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return core.AESEncode(data, key.AESKey)
+		},
+		decode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return core.AESDecode(data, key.AESKey)
+		},
+	})
+	MustRegisterCodec(&funcCodec{
+		name: string(core.AESGCM),
+		keys: []KeyKind{KeyAES},
+		encode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return core.AESGCMEncode(data, key.AESKey)
+		},
+		decode: func(data []byte, key *CipherKey) ([]byte, error) {
+			return core.AESGCMDecode(data, key.AESKey)
+		},
+	})
+	MustRegisterCodec(&funcCodec{
+		name: string(core.RSA),
+		keys: []KeyKind{KeyRSAPublic, KeyRSAPrivate},
+		encode: func(data []byte, key *CipherKey) ([]byte, error) {
+			//使用公钥加密，只有持有私钥的一端能解开
+			publicKey := key.RsaPublicKey
+			if publicKey == nil && key.RsaPrivateKey != nil {
+				publicKey = &key.RsaPrivateKey.PublicKey
+			}
+			if publicKey == nil {
+				return nil, fmt.Errorf("rsa 公钥未配置")
+			}
+			return core.EncryptHybridRSA(publicKey, data)
+		},
+		decode: func(data []byte, key *CipherKey) ([]byte, error) {
+			//使用私钥解密
+			if key.RsaPrivateKey == nil {
+				return nil, fmt.Errorf("rsa 私钥未配置")
+			}
+			return core.DecryptHybridRSA(key.RsaPrivateKey, data)
+		},
+	})
+	registerCompressCodec(core.Gzip, core.GzipEncode, core.GzipDecode)
+	registerCompressCodec(core.Deflate, core.DeflateEncode, core.DeflateDecode)
+	registerCompressCodec(core.Zlib, core.ZlibEncode, core.ZlibDecode)
+	addStreamSupport()
+}
+
+// 压缩类编解码器不需要密钥
+func registerCompressCodec(name core.CryptoAlgorithm, encode func([]byte) ([]byte, error), decode func([]byte) ([]byte, error)) {
+	MustRegisterCodec(&funcCodec{
+		name: string(name),
+		encode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return encode(data)
+		},
+		decode: func(data []byte, _ *CipherKey) ([]byte, error) {
+			return decode(data)
+		},
+	})
+}
+
+func xorCrypto(data []byte, key *CipherKey) ([]byte, error) {
+	if len(key.XorKey) == 0 {
+		return nil, fmt.Errorf("xor 密钥未配置")
+	}
+	return core.XorCrypto(data, key.XorKey), nil
+}
@@ -0,0 +1,132 @@
+package c2
+
+import (
+	"bytes"
+	"caffeine/core"
+	"errors"
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 测试用的自定义编解码器：逐字节取反
+type invertCodec struct{}
+
+func (invertCodec) Name() string { return "invert" }
+
+func (invertCodec) Encode(data []byte, _ *CipherKey) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = ^b
+	}
+	return out, nil
+}
+
+func (c invertCodec) Decode(data []byte, key *CipherKey) ([]byte, error) {
+	return c.Encode(data, key)
+}
+
+func (invertCodec) RequiredKeys() []KeyKind { return nil }
+
+func TestRegisterCodec(t *testing.T) {
+	if _, ok := GetCodec("invert"); !ok {
+		if err := RegisterCodec(invertCodec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RegisterCodec(invertCodec{}); err == nil {
+		t.Fatal("expected duplicate registration to fail")
+	}
+
+	conf := C2Yaml{
+		Request:  C2Request{Method: "POST", EncodeChain: "invert->hex->base64"},
+		Response: C2Response{EncodeChain: "invert->hex->base64"},
+	}
+	session := &core.Session{Target: core.Target{ShellURL: "http://127.0.0.1/"}}
+	req, err := NewRequestHandler(conf).Handler(session, []byte("echo 'hello';"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewResponseHandler(conf).Handler(session, core.NewHttpResponse(200, nil, req.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("echo 'hello';")) {
+		t.Fatalf("round trip mismatch: %s", data)
+	}
+}
+
+func TestUnregisteredCodecRejected(t *testing.T) {
+	var conf C2Yaml
+	err := yaml.Unmarshal([]byte("request:\n  method: POST\n  encode_chain: hex->rot13\n"), &conf)
+	if err == nil {
+		t.Fatal("expected unregistered codec to be rejected")
+	}
+	err = yaml.Unmarshal([]byte("response:\n  encode_chain: rot13\n"), &conf)
+	if err == nil {
+		t.Fatal("expected unregistered codec to be rejected")
+	}
+}
+
+func TestAESGCMIntegrity(t *testing.T) {
+	codec, _ := GetCodec(string(core.AESGCM))
+	key := &CipherKey{AESKey: bytes.Repeat([]byte{7}, 32)}
+	encoded, err := codec.Encode([]byte("whoami"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(encoded, key)
+	if err != nil || string(decoded) != "whoami" {
+		t.Fatalf("round trip failed: %s %v", decoded, err)
+	}
+	encoded[len(encoded)-1] ^= 1
+	if _, err := codec.Decode(encoded, key); !errors.Is(err, core.ErrIntegrity) {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+}
+
+func TestCompressCodecs(t *testing.T) {
+	listing := bytes.Repeat([]byte(`{"name":"index.php","size":1024,"permissions":33188},`), 200)
+	for _, name := range []core.CryptoAlgorithm{core.Gzip, core.Deflate, core.Zlib} {
+		codec, ok := GetCodec(string(name))
+		if !ok {
+			t.Fatalf("%s not registered", name)
+		}
+		encoded, err := codec.Encode(listing, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encoded) >= len(listing)/4 {
+			t.Fatalf("%s: poor compression %d -> %d", name, len(listing), len(encoded))
+		}
+		decoded, err := codec.Decode(encoded, nil)
+		if err != nil || !bytes.Equal(decoded, listing) {
+			t.Fatalf("%s: round trip failed: %v", name, err)
+		}
+	}
+}
+
+func TestRSAHybridRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("../../profiles/c2.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf C2Yaml
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Key.RsaPrivateKey == nil || conf.Key.RsaPublicKey == nil {
+		t.Fatal("rsa keys not loaded from profile")
+	}
+	codec, _ := GetCodec(string(core.RSA))
+	payload := bytes.Repeat([]byte("system('id');"), 100)
+	encoded, err := codec.Encode(payload, &conf.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(encoded, &conf.Key)
+	if err != nil || !bytes.Equal(decoded, payload) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
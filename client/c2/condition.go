@@ -0,0 +1,115 @@
+package c2
+
+import (
+	"caffeine/core"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 请求条件类型，服务端依据这些条件路由到webshell
+const (
+	ConditionGetParameter = "GetParameter" // 查询参数,value: name=value
+	ConditionCookie       = "Cookie"       // Cookie,value: name=value
+	ConditionHeader       = "Header"       // 请求头,value: name=value
+	ConditionPath         = "Path"         // 路径后缀,value: /api/sdk
+)
+
+// SessionCookieName 服务端保存会话密钥所用的会话Cookie(PHP默认会话名)
+const SessionCookieName = "PHPSESSID"
+
+// ConditionTypes 支持的所有条件类型
+var ConditionTypes = []string{ConditionGetParameter, ConditionCookie, ConditionHeader, ConditionPath}
+
+// Validate 校验条件类型与表达式
+func (c ReqCondition) Validate() error {
+	switch c.Type {
+	case ConditionGetParameter, ConditionCookie, ConditionHeader:
+		if !core.ValidateExpress(c.Value, "=") {
+			return fmt.Errorf("无效表达式.请以=分割: %s", c.Value)
+		}
+		if strings.TrimSpace(c.name()) == "" {
+			return fmt.Errorf("条件 %s 缺少名称: %s", c.Type, c.Value)
+		}
+	case ConditionPath:
+		if c.Value == "" {
+			return fmt.Errorf("路径后缀不能为空")
+		}
+	default:
+		return fmt.Errorf("不支持的条件类型:%s", c.Type)
+	}
+	return nil
+}
+
+func (c ReqCondition) name() string {
+	return strings.SplitN(c.Value, "=", 2)[0]
+}
+
+func (c ReqCondition) value() string {
+	split := strings.SplitN(c.Value, "=", 2)
+	if len(split) < 2 {
+		return ""
+	}
+	return split[1]
+}
+
+// Apply 将条件应用到请求上
+func (c ReqCondition) Apply(req *core.HttpRequest) error {
+	switch c.Type {
+	case ConditionGetParameter:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return fmt.Errorf("解析请求地址失败: %v", err)
+		}
+		query := u.Query()
+		query.Set(c.name(), c.value())
+		u.RawQuery = query.Encode()
+		req.URL = u.String()
+	case ConditionCookie:
+		cookie := c.name() + "=" + c.value()
+		if exists := req.Headers["Cookie"]; exists != "" {
+			cookie = exists + "; " + cookie
+		}
+		req.Headers["Cookie"] = cookie
+	case ConditionHeader:
+		req.Headers[c.name()] = c.value()
+	case ConditionPath:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return fmt.Errorf("解析请求地址失败: %v", err)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(c.Value, "/")
+		req.URL = u.String()
+	default:
+		return fmt.Errorf("不支持的条件类型:%s", c.Type)
+	}
+	return nil
+}
+
+// Match 服务端视角：判断请求是否满足条件
+func (c ReqCondition) Match(req *core.HttpRequest) bool {
+	switch c.Type {
+	case ConditionGetParameter:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return false
+		}
+		return u.Query().Get(c.name()) == c.value()
+	case ConditionCookie:
+		for _, cookie := range strings.Split(req.Headers["Cookie"], ";") {
+			if strings.TrimSpace(cookie) == c.name()+"="+c.value() {
+				return true
+			}
+		}
+		return false
+	case ConditionHeader:
+		return req.Headers[c.name()] == c.value()
+	case ConditionPath:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return false
+		}
+		return strings.HasSuffix(u.Path, "/"+strings.TrimPrefix(c.Value, "/"))
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package c2
+
+import (
+	"caffeine/core"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConditionApply(t *testing.T) {
+	conf := C2Yaml{
+		Request: C2Request{
+			Method:      "POST",
+			EncodeChain: "base64",
+			Condition: []ReqCondition{
+				{Type: ConditionGetParameter, Value: "api=sdk"},
+				{Type: ConditionPath, Value: "/log"},
+				{Type: ConditionCookie, Value: "sid=1"},
+				{Type: ConditionHeader, Value: "X-Trace=abc"},
+			},
+			Headers: []string{"Cookie:lang=en"},
+		},
+	}
+	session := &core.Session{Target: core.Target{ShellURL: "http://127.0.0.1/shell/server.php"}}
+	req, err := NewRequestHandler(conf).Handler(session, []byte("echo 1;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL != "http://127.0.0.1/shell/server.php/log?api=sdk" {
+		t.Fatalf("unexpected url: %s", req.URL)
+	}
+	if req.Headers["Cookie"] != "lang=en; sid=1" {
+		t.Fatalf("unexpected cookie: %s", req.Headers["Cookie"])
+	}
+	if req.Headers["X-Trace"] != "abc" {
+		t.Fatalf("unexpected header: %s", req.Headers["X-Trace"])
+	}
+}
+
+func TestConditionUnknownType(t *testing.T) {
+	data := `
+method: POST
+condition:
+  - type: PostParameter
+    value: a=b
+`
+	var req C2Request
+	if err := yaml.Unmarshal([]byte(data), &req); err == nil {
+		t.Fatal("expected unknown condition type to be rejected")
+	}
+}
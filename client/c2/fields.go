@@ -0,0 +1,109 @@
+package c2
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 未知字段检查：yaml.v3 的 KnownFields 不会传递到自定义 UnmarshalYAML 内部，
+// 因此按结构体的 yaml 标签逐级检查，并对拼写错误给出建议
+
+// unknownFields 检查配置文档中的未知字段
+func unknownFields(root *yaml.Node) []Diagnostic {
+	return checkFields(root, reflect.TypeOf(C2Yaml{}), "")
+}
+
+func checkFields(node *yaml.Node, typ reflect.Type, path string) []Diagnostic {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var diags []Diagnostic
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil // 类型错误由解码报告
+		}
+		fields := yamlFields(typ)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldPath := joinPath(path, key.Value)
+			field, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("第%d行: 未知字段 %s", key.Line, key.Value)
+				if suggestion := suggest(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf("，是否为 %s?", suggestion)
+				}
+				diags = append(diags, Diagnostic{fieldPath, SeverityError, message})
+				continue
+			}
+			diags = append(diags, checkFields(value, field.Type, fieldPath)...)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range node.Content {
+			diags = append(diags, checkFields(item, typ.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return diags
+}
+
+// yamlFields 结构体中可由YAML设置的字段(按标签名)
+func yamlFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if tag == "" {
+			// 无标签字段为运行时数据(如解析后的密钥)，不允许出现在配置中
+			continue
+		}
+		fields[tag] = field
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest 返回编辑距离最近的字段名
+func suggest(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", len(key)/2+2
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
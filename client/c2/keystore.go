@@ -0,0 +1,282 @@
+package c2
+
+import (
+	"caffeine/core"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 本地密钥库：每个密钥保存为目录下的一个YAML文件，配置中通过ID引用
+
+// 密钥库中的密钥类型
+const (
+	StoredAES = "aes"
+	StoredXor = "xor"
+	StoredRSA = "rsa" // RSA私钥，公钥由私钥导出
+)
+
+// StoredKeyTypes 支持的全部密钥类型
+var StoredKeyTypes = []string{StoredAES, StoredXor, StoredRSA}
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// StoredKey 密钥库中的一个密钥
+type StoredKey struct {
+	ID       string    `yaml:"id" json:"id"`
+	Type     string    `yaml:"type" json:"type"`
+	Material string    `yaml:"material" json:"-"` // Base64，与配置中的 aes/xor/rsa_private 格式一致
+	Created  time.Time `yaml:"created" json:"created"`
+}
+
+// PublicKey 返回RSA密钥的公钥(Base64 PKIX)，用于 rsa_public 或服务端
+func (k *StoredKey) PublicKey() (string, error) {
+	if k.Type != StoredRSA {
+		return "", fmt.Errorf("密钥 %s 不是 RSA 密钥", k.ID)
+	}
+	privateKey, err := parseRSAPrivate(k.Material)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// KeyStore 本地密钥库
+type KeyStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+var (
+	keyStore   *KeyStore
+	keyStoreMu sync.Mutex
+)
+
+// GetKeyStore 返回全局密钥库，目录由 core.BasicConfig.KeyStoreDir 指定
+func GetKeyStore() *KeyStore {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+	if keyStore == nil {
+		keyStore = NewKeyStore(core.GetInstance().KeyStoreDir)
+	}
+	return keyStore
+}
+
+// SetKeyStore 替换全局密钥库，用于指定其他目录
+func SetKeyStore(store *KeyStore) {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+	keyStore = store
+}
+
+// NewKeyStore 使用指定目录创建密钥库，目录在首次保存时创建
+func NewKeyStore(dir string) *KeyStore {
+	return &KeyStore{dir: dir}
+}
+
+// Dir 密钥库目录
+func (s *KeyStore) Dir() string {
+	return s.dir
+}
+
+func (s *KeyStore) path(id string) string {
+	return filepath.Join(s.dir, id+".yaml")
+}
+
+// Get 根据ID读取密钥
+func (s *KeyStore) Get(id string) (*StoredKey, error) {
+	if !keyIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("无效的密钥ID: %q", id)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("密钥 %s 不存在于密钥库 %s", id, s.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key StoredKey
+	if err := yaml.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("密钥 %s 格式错误: %v", id, err)
+	}
+	if key.ID != id {
+		return nil, fmt.Errorf("密钥文件 %s 中的ID为 %s", s.path(id), key.ID)
+	}
+	return &key, nil
+}
+
+// List 列出全部密钥(按ID排序)，不可读的文件将被忽略
+func (s *KeyStore) List() ([]*StoredKey, error) {
+	s.mu.RLock()
+	entries, err := os.ReadDir(s.dir)
+	s.mu.RUnlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*StoredKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		if key, err := s.Get(strings.TrimSuffix(entry.Name(), ".yaml")); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Save 保存密钥，ID已存在时返回错误
+func (s *KeyStore) Save(key *StoredKey) error {
+	if !keyIDPattern.MatchString(key.ID) {
+		return fmt.Errorf("无效的密钥ID: %q", key.ID)
+	}
+	if err := validateStoredKey(key); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path(key.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if os.IsExist(err) {
+		return fmt.Errorf("密钥 %s 已存在", key.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Delete 删除密钥
+func (s *KeyStore) Delete(id string) error {
+	if !keyIDPattern.MatchString(id) {
+		return fmt.Errorf("无效的密钥ID: %q", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); os.IsNotExist(err) {
+		return fmt.Errorf("密钥 %s 不存在", id)
+	} else {
+		return err
+	}
+}
+
+// Generate 生成并保存新密钥
+// size: aes 为字节数(16/24/32，默认32)，xor 为字节数(默认16)，rsa 为位数(默认2048)
+func (s *KeyStore) Generate(id, keyType string, size int) (*StoredKey, error) {
+	material, err := GenerateKeyMaterial(keyType, size)
+	if err != nil {
+		return nil, err
+	}
+	key := &StoredKey{ID: id, Type: keyType, Material: material, Created: time.Now()}
+	if err := s.Save(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateKeyMaterial 生成Base64编码的密钥材料
+func GenerateKeyMaterial(keyType string, size int) (string, error) {
+	switch keyType {
+	case StoredAES:
+		if size == 0 {
+			size = 32
+		}
+		if size != 16 && size != 24 && size != 32 {
+			return "", fmt.Errorf("AES 密钥的长度无效，应为 16、24 或 32 字节")
+		}
+		return randomKey(size)
+	case StoredXor:
+		if size == 0 {
+			size = 16
+		}
+		if size <= 0 {
+			return "", fmt.Errorf("xor 密钥长度无效: %d", size)
+		}
+		return randomKey(size)
+	case StoredRSA:
+		if size == 0 {
+			size = 2048
+		}
+		if size < 2048 {
+			return "", fmt.Errorf("RSA 密钥至少 2048 位")
+		}
+		privateKey, err := rsa.GenerateKey(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(privateKey)), nil
+	}
+	return "", fmt.Errorf("不支持的密钥类型:%s，可用: %s", keyType, strings.Join(StoredKeyTypes, ", "))
+}
+
+func randomKey(size int) (string, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// validateStoredKey 校验密钥材料与类型是否匹配
+func validateStoredKey(key *StoredKey) error {
+	var err error
+	switch key.Type {
+	case StoredAES:
+		_, err = parseAESKey(key.Material)
+	case StoredXor:
+		_, err = parseXorKey(key.Material)
+	case StoredRSA:
+		_, err = parseRSAPrivate(key.Material)
+	default:
+		err = fmt.Errorf("不支持的密钥类型:%s", key.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("密钥 %s: %v", key.ID, err)
+	}
+	return nil
+}
+
+// KeyReference 配置使用的一个密钥
+type KeyReference struct {
+	Kind KeyKind `json:"kind"`
+	ID   string  `json:"id,omitempty"` // 为空表示内联在配置中
+}
+
+func (r KeyReference) String() string {
+	if r.ID == "" {
+		return string(r.Kind) + "=inline"
+	}
+	return string(r.Kind) + "=" + r.ID
+}
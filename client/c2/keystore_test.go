@@ -0,0 +1,73 @@
+package c2
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeyStoreReferences(t *testing.T) {
+	store := NewKeyStore(t.TempDir())
+
+	for _, key := range []struct{ id, keyType string }{{"team-aes", StoredAES}, {"team-xor", StoredXor}, {"ops-rsa", StoredRSA}} {
+		if _, err := store.Generate(key.id, key.keyType, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Generate("team-aes", StoredAES, 0); err == nil {
+		t.Fatal("expected duplicate id to fail")
+	}
+	if keys, err := store.List(); err != nil || len(keys) != 3 {
+		t.Fatalf("unexpected keys: %v %v", keys, err)
+	}
+
+	const source = `
+name: ref
+request:
+  method: POST
+  encode_chain: aes->xor->base64
+response:
+  encode_chain: rsa->base64
+key:
+  aes_id: team-aes
+  xor_id: team-xor
+  rsa_id: ops-rsa
+`
+	// 解析配置时不访问密钥库，引用由调用方指定的密钥库解析
+	var profile C2Yaml
+	if err := yaml.Unmarshal([]byte(source), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Key.AESKey != nil || profile.Key.Resolve(nil) == nil {
+		t.Fatal("references must not be resolved without a key store")
+	}
+	if err := profile.Key.Resolve(store); err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Key.AESKey) != 32 || len(profile.Key.XorKey) != 16 || profile.Key.RsaPrivateKey == nil {
+		t.Fatal("key references were not resolved")
+	}
+	if profile.Key.AES != "" {
+		t.Fatal("resolved material must not be copied into the profile")
+	}
+	if report := SelfTest(profile, []byte("id")); !report.OK() {
+		t.Fatalf("%+v", report.Failed())
+	}
+
+	library, err := NewProfileLibrary(writeProfiles(t, map[string]string{"ref.yaml": source}), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := library.Get("ref"); err != nil || loaded.Key.RsaPrivateKey == nil {
+		t.Fatalf("library did not resolve references: %v", err)
+	}
+
+	var mismatch CipherKey
+	if err := yaml.Unmarshal([]byte("aes_id: team-xor\n"), &mismatch); err != nil {
+		t.Fatal(err)
+	}
+	if err := mismatch.Resolve(store); err == nil || !strings.Contains(err.Error(), "aes_id") {
+		t.Fatalf("expected type mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package c2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置库：加载目录下的全部C2配置，按 name 索引，支持 extends 继承
+
+// profileSource 配置文件的原始内容
+type profileSource struct {
+	file    string
+	extends string
+	node    *yaml.Node // 文档根节点(mapping)
+}
+
+// ProfileLibrary C2配置库
+type ProfileLibrary struct {
+	dir      string
+	keys     *KeyStore // 解析 key.*_id 引用的密钥库
+	mu       sync.RWMutex
+	profiles map[string]C2Yaml
+	files    map[string]string // name -> 文件路径
+	errors   map[string]error  // 文件或配置名 -> 加载错误
+}
+
+// NewProfileLibrary 创建配置库并加载目录，目录不存在时为空库
+// keys 为 nil 时引用密钥库的配置加载失败
+func NewProfileLibrary(dir string, keys *KeyStore) (*ProfileLibrary, error) {
+	library := &ProfileLibrary{dir: dir, keys: keys}
+	return library, library.Load()
+}
+
+// Dir 配置目录
+func (l *ProfileLibrary) Dir() string {
+	return l.dir
+}
+
+// Load 重新加载目录中的全部配置
+// 单个配置出错不影响其他配置，错误可通过 Errors 获取，返回值为汇总错误
+func (l *ProfileLibrary) Load() error {
+	sources := make(map[string]*profileSource)
+	errs := make(map[string]error)
+
+	files, err := profileFiles(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		source, name, err := readProfileSource(file)
+		if err != nil {
+			errs[file] = err
+			continue
+		}
+		if exists, ok := sources[name]; ok {
+			errs[file] = fmt.Errorf("配置名称 %s 与 %s 重复", name, exists.file)
+			continue
+		}
+		sources[name] = source
+	}
+
+	profiles := make(map[string]C2Yaml)
+	names := make(map[string]string)
+	for name, source := range sources {
+		node, err := resolveProfile(name, sources, nil)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		profile, err := decodeProfile(node)
+		if err == nil {
+			err = profile.Key.Resolve(l.keys)
+		}
+		if err != nil {
+			errs[name] = fmt.Errorf("%s: %v", source.file, err)
+			continue
+		}
+		profile.Name = name
+		profile.Extends = source.extends
+		profiles[name] = profile
+		names[name] = source.file
+	}
+
+	l.mu.Lock()
+	l.profiles, l.files, l.errors = profiles, names, errs
+	l.mu.Unlock()
+	if len(errs) > 0 {
+		return fmt.Errorf("%d 个配置加载失败", len(errs))
+	}
+	return nil
+}
+
+// Get 根据名称获取配置
+func (l *ProfileLibrary) Get(name string) (C2Yaml, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if profile, ok := l.profiles[name]; ok {
+		return profile, nil
+	}
+	if err, ok := l.errors[name]; ok {
+		return C2Yaml{}, fmt.Errorf("配置 %s 加载失败: %v", name, err)
+	}
+	return C2Yaml{}, fmt.Errorf("配置 %s 不存在", name)
+}
+
+// File 返回配置所在文件
+func (l *ProfileLibrary) File(name string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.files[name]
+}
+
+// Names 返回全部可用配置名称(已排序)
+func (l *ProfileLibrary) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	names := make([]string, 0, len(l.profiles))
+	for name := range l.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileInfo 配置概要
+type ProfileInfo struct {
+	Name    string         `json:"name"`
+	File    string         `json:"file"`
+	Extends string         `json:"extends,omitempty"`
+	Keys    []KeyReference `json:"keys"` // 使用的密钥，内联密钥的ID为空
+}
+
+// List 返回全部可用配置的概要(按名称排序)
+func (l *ProfileLibrary) List() []ProfileInfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	infos := make([]ProfileInfo, 0, len(l.profiles))
+	for name, profile := range l.profiles {
+		infos = append(infos, ProfileInfo{
+			Name:    name,
+			File:    l.files[name],
+			Extends: profile.Extends,
+			Keys:    profile.Key.References(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Errors 返回上次加载的错误
+func (l *ProfileLibrary) Errors() map[string]error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	errs := make(map[string]error, len(l.errors))
+	for k, v := range l.errors {
+		errs[k] = v
+	}
+	return errs
+}
+
+// profileFiles 列出目录下的YAML文件
+func profileFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// readProfileSource 读取配置文件，未设置 name 时使用文件名
+func readProfileSource(file string) (*profileSource, string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("配置文件根节点必须是映射")
+	}
+	root := doc.Content[0]
+	if _, _, err := MigrateNode(root); err != nil {
+		return nil, "", err
+	}
+	var meta struct {
+		Name    string `yaml:"name"`
+		Extends string `yaml:"extends"`
+	}
+	if err := root.Decode(&meta); err != nil {
+		return nil, "", err
+	}
+	name := meta.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return &profileSource{file: file, extends: meta.Extends, node: root}, name, nil
+}
+
+// resolveProfile 展开继承链，子配置覆盖父配置
+func resolveProfile(name string, sources map[string]*profileSource, chain []string) (*yaml.Node, error) {
+	for _, visited := range chain {
+		if visited == name {
+			return nil, fmt.Errorf("配置循环继承: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+	}
+	source, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("继承的配置 %s 不存在", name)
+	}
+	if source.extends == "" {
+		return source.node, nil
+	}
+	base, err := resolveProfile(source.extends, sources, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+	return mergeNode(base, source.node), nil
+}
+
+// mergeNode 合并映射节点：映射递归合并，其他类型(标量、序列)由 override 整体替换
+func mergeNode(base, override *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: base.Tag}
+	index := make(map[string]int)
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		if base.Content[i].Value == "extends" {
+			continue
+		}
+		index[base.Content[i].Value] = len(merged.Content)
+		merged.Content = append(merged.Content, base.Content[i], base.Content[i+1])
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if key.Value == "extends" {
+			continue
+		}
+		if at, ok := index[key.Value]; ok {
+			merged.Content[at+1] = mergeNode(merged.Content[at+1], value)
+			continue
+		}
+		index[key.Value] = len(merged.Content)
+		merged.Content = append(merged.Content, key, value)
+	}
+	return merged
+}
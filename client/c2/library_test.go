@@ -0,0 +1,84 @@
+package c2
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestProfileLibraryExtends(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base.yaml": `
+name: base
+request:
+  method: POST
+  encode_chain: base64
+  headers:
+    - "Accept:*/*"
+response:
+  encode_chain: base64
+  code: 200
+`,
+		"child.yml": `
+extends: base
+request:
+  encode_chain: hex->base64
+  condition:
+    - type: GetParameter
+      value: api=sdk
+`,
+		"notes.txt": "ignored",
+	})
+	library, err := NewProfileLibrary(dir, nil)
+	if err != nil {
+		t.Fatalf("%v: %v", err, library.Errors())
+	}
+	if names := strings.Join(library.Names(), ","); names != "base,child" {
+		t.Fatalf("unexpected profiles: %s", names)
+	}
+	child, err := library.Get("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.Name != "child" || child.Extends != "base" {
+		t.Fatalf("unexpected name/extends: %s/%s", child.Name, child.Extends)
+	}
+	// 覆盖的字段使用子配置，未覆盖的字段继承父配置
+	if child.Request.EncodeChain != "hex->base64" || child.Request.Method != "POST" ||
+		len(child.Request.Headers) != 1 || len(child.Request.Condition) != 1 || child.Response.Code != 200 {
+		t.Fatalf("unexpected merged profile: %+v", child)
+	}
+}
+
+func TestProfileLibraryErrors(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"a.yaml":   "name: a\nextends: b\n",
+		"b.yaml":   "name: b\nextends: a\n",
+		"ok.yaml":  "name: ok\nrequest:\n  method: GET\n",
+		"dup.yaml": "name: ok\nrequest:\n  method: GET\n",
+	})
+	library, err := NewProfileLibrary(dir, nil)
+	if err == nil {
+		t.Fatal("expected load errors")
+	}
+	if _, err := library.Get("ok"); err != nil {
+		t.Fatalf("valid profile should still load: %v", err)
+	}
+	if _, err := library.Get("a"); err == nil || !strings.Contains(err.Error(), "循环继承") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	if len(library.Errors()) != 3 {
+		t.Fatalf("expected 3 errors, got %v", library.Errors())
+	}
+}
@@ -0,0 +1,333 @@
+package c2
+
+import (
+	"caffeine/core"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置检查(lint)，在连接目标前发现配置问题
+
+// Severity 诊断级别
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // 配置无法使用
+	SeverityWarning Severity = "warning" // 可以使用，但很可能不符合预期
+)
+
+// Diagnostic 一条诊断信息
+type Diagnostic struct {
+	Path     string   `json:"path"` // 字段路径，如 request.encode_chain[1]
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", d.Severity, d.Path, d.Message)
+}
+
+// HasErrors 是否存在错误级别的诊断
+func HasErrors(diags []Diagnostic) bool {
+	return firstError(diags) != nil
+}
+
+// firstError 返回第一条错误级别的诊断
+func firstError(diags []Diagnostic) error {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return fmt.Errorf("%s: %s", d.Path, d.Message)
+		}
+	}
+	return nil
+}
+
+// TextCodec 输出字符集固定的编解码器(如base64、hex)，用于检查填充冲突
+type TextCodec interface {
+	Alphabet() string
+}
+
+// Lint 检查C2配置，返回全部问题，key.*_id 引用的密钥从全局密钥库检查
+func Lint(conf C2Yaml) []Diagnostic {
+	return LintWithStore(conf, GetKeyStore())
+}
+
+// LintWithStore 同 Lint，key.*_id 引用的密钥从指定的密钥库检查，为 nil 时不检查密钥库
+func LintWithStore(conf C2Yaml, store *KeyStore) []Diagnostic {
+	var diags []Diagnostic
+	if conf.Name == "" {
+		diags = append(diags, Diagnostic{"name", SeverityWarning, "未设置配置名称"})
+	}
+	diags = append(diags, lintRequest(conf.Request)...)
+	diags = append(diags, lintResponse(conf.Response)...)
+	diags = append(diags, lintKey(conf.Key, store)...)
+	diags = append(diags, lintChainKeys("request.encode_chain", conf.Request.EncodeChain, conf.Key)...)
+	diags = append(diags, lintChainKeys("response.encode_chain", conf.Response.EncodeChain, conf.Key)...)
+	diags = append(diags, lintPadding("request", conf.Request.EncodeChain, conf.Request.FrontPadding, conf.Request.BackPadding)...)
+	diags = append(diags, lintPadding("response", conf.Response.EncodeChain, conf.Response.FrontPadding, conf.Response.BackPadding)...)
+	diags = append(diags, lintBasic(conf.Basic)...)
+	return diags
+}
+
+// LintBytes 迁移到当前版本并检查未知字段后宽松解析，解析阶段的校验错误同样以诊断形式返回
+func LintBytes(data []byte) []Diagnostic {
+	return LintBytesWithStore(data, GetKeyStore())
+}
+
+// LintBytesWithStore 同 LintBytes，使用指定的密钥库
+func LintBytesWithStore(data []byte, store *KeyStore) []Diagnostic {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []Diagnostic{{"", SeverityError, fmt.Sprintf("YAML 解析失败: %v", err)}}
+	}
+	if len(doc.Content) == 0 {
+		return []Diagnostic{{"", SeverityError, "配置文件为空"}}
+	}
+	from, migrated, err := MigrateNode(&doc)
+	if err != nil {
+		return []Diagnostic{{"version", SeverityError, err.Error()}}
+	}
+	var diags []Diagnostic
+	if from != CurrentVersion {
+		diags = append(diags, Diagnostic{"version", SeverityWarning,
+			fmt.Sprintf("配置版本 %d 已过时，可使用 c2ctl migrate -w 升级: %s", from, strings.Join(migrated, "; "))})
+	}
+	diags = append(diags, unknownFields(doc.Content[0])...)
+
+	var raw struct {
+		Version  int           `yaml:"version"`
+		Name     string        `yaml:"name"`
+		Extends  string        `yaml:"extends"`
+		Request  rawC2Request  `yaml:"request"`
+		Response rawC2Response `yaml:"response"`
+		Key      rawCipherKey  `yaml:"key"`
+		Basic    C2Basic       `yaml:"basic"`
+	}
+	if err := doc.Content[0].Decode(&raw); err != nil {
+		return append(diags, Diagnostic{"", SeverityError, fmt.Sprintf("YAML 解析失败: %v", err)})
+	}
+	return append(diags, LintWithStore(C2Yaml{
+		Version:  raw.Version,
+		Name:     raw.Name,
+		Extends:  raw.Extends,
+		Request:  C2Request(raw.Request),
+		Response: C2Response(raw.Response),
+		Key:      CipherKey(raw.Key),
+		Basic:    raw.Basic,
+	}, store)...)
+}
+
+func lintRequest(r C2Request) []Diagnostic {
+	var diags []Diagnostic
+	if !slices.Contains(RequestMethods, r.Method) {
+		diags = append(diags, Diagnostic{"request.method", SeverityError, fmt.Sprintf("无效的请求方法:%s", r.Method)})
+	}
+	diags = append(diags, lintHeaders("request.headers", r.Headers)...)
+	for i, condition := range r.Condition {
+		if err := condition.Validate(); err != nil {
+			diags = append(diags, Diagnostic{fmt.Sprintf("request.condition[%d]", i), SeverityError, err.Error()})
+		}
+	}
+	if err := r.Payload.Validate(); err != nil {
+		diags = append(diags, Diagnostic{"request.payload.location", SeverityError, err.Error()})
+	} else if r.Payload.location() != PayloadBody && r.Payload.Name == "" {
+		diags = append(diags, Diagnostic{"request.payload.name", SeverityWarning, "未设置字段名，需由 shell 密码提供"})
+	}
+	if r.Method == "GET" && (r.Payload.location() == PayloadForm || r.Payload.location() == PayloadMultipart || r.Payload.location() == PayloadBody) {
+		diags = append(diags, Diagnostic{"request.payload.location", SeverityWarning, fmt.Sprintf("GET 请求的%s载荷可能被服务端忽略", r.Payload.location())})
+	}
+	if r.Payload.location() == PayloadForm && (strings.TrimSpace(r.EncodeChain) != "" || r.FrontPadding != "" || r.BackPadding != "") {
+		diags = append(diags, Diagnostic{"request.payload.location", SeverityWarning,
+			"Generate 生成的一句话 shell 直接执行表单字段，不会解码加密链或去除填充，需使用 shell.php 或 profiles/eval.yaml 的配置"})
+	}
+	diags = append(diags, lintChain("request.encode_chain", r.EncodeChain)...)
+	if strings.TrimSpace(r.EncodeChain) == "" {
+		diags = append(diags, Diagnostic{"request.encode_chain", SeverityWarning, "未配置加密链，载荷将以明文发送"})
+	}
+	return diags
+}
+
+func lintResponse(r C2Response) []Diagnostic {
+	var diags []Diagnostic
+	if r.Code != 0 && (r.Code < 100 || r.Code > 599) {
+		diags = append(diags, Diagnostic{"response.code", SeverityError, fmt.Sprintf("无效的状态码:%d", r.Code)})
+	}
+	diags = append(diags, lintHeaders("response.headers", r.Headers)...)
+	diags = append(diags, lintChain("response.encode_chain", r.EncodeChain)...)
+	return diags
+}
+
+func lintHeaders(path string, headers []string) []Diagnostic {
+	var diags []Diagnostic
+	for i, header := range headers {
+		if !core.ValidateExpress(header, ":") {
+			diags = append(diags, Diagnostic{fmt.Sprintf("%s[%d]", path, i), SeverityError, "无效header.请以:分割"})
+		}
+	}
+	return diags
+}
+
+// lintChain 逐个检查加密链中的编解码器是否已注册
+func lintChain(path, chain string) []Diagnostic {
+	if strings.TrimSpace(chain) == "" {
+		return nil
+	}
+	var diags []Diagnostic
+	for i, name := range strings.Split(chain, chainSeparator) {
+		name = strings.TrimSpace(name)
+		if _, ok := GetCodec(name); !ok {
+			diags = append(diags, Diagnostic{fmt.Sprintf("%s[%d]", path, i), SeverityError,
+				fmt.Sprintf("未注册的编解码器: %q，可用: %s", name, strings.Join(CodecNames(), ", "))})
+		}
+	}
+	return diags
+}
+
+func lintKey(key CipherKey, store *KeyStore) []Diagnostic {
+	var diags []Diagnostic
+	if key.Exchange != "" && key.Exchange != KeyExchangeX25519 {
+		diags = append(diags, Diagnostic{"key.exchange", SeverityError, fmt.Sprintf("不支持的密钥协商方式:%s", key.Exchange)})
+	}
+	if key.Exchange != "" && !hasKey(key, KeyAES) {
+		diags = append(diags, Diagnostic{"key.exchange", SeverityError, "密钥协商需要 key.aes 用于认证"})
+	}
+	if key.AES != "" {
+		if _, err := parseAESKey(key.AES); err != nil {
+			diags = append(diags, Diagnostic{"key.aes", SeverityError, err.Error()})
+		}
+	}
+	if key.Xor != "" {
+		if _, err := parseXorKey(key.Xor); err != nil {
+			diags = append(diags, Diagnostic{"key.xor", SeverityError, err.Error()})
+		}
+	}
+	if key.RsaPublic != "" {
+		if _, err := parseRSAPublicKey(key.RsaPublic); err != nil {
+			diags = append(diags, Diagnostic{"key.rsa_public", SeverityError, err.Error()})
+		} else if _, legacy := legacyRSAKey(key.RsaPublic); legacy {
+			diags = append(diags, Diagnostic{"key.rsa_public", SeverityWarning, "旧格式的密钥(PEM正文再次Base64编码)，可使用 c2ctl migrate -w 升级"})
+		}
+	}
+	if key.RsaPrivate != "" {
+		if _, err := parseRSAPrivate(key.RsaPrivate); err != nil {
+			diags = append(diags, Diagnostic{"key.rsa_private", SeverityError, err.Error()})
+		} else if _, legacy := legacyRSAKey(key.RsaPrivate); legacy {
+			diags = append(diags, Diagnostic{"key.rsa_private", SeverityWarning, "旧格式的密钥(PEM正文再次Base64编码)，可使用 c2ctl migrate -w 升级"})
+		}
+	}
+	// 逐个解析密钥库引用，分别报告
+	refs := []struct {
+		path  string
+		probe CipherKey
+	}{
+		{"key.aes_id", CipherKey{AESID: key.AESID, AES: key.AES}},
+		{"key.xor_id", CipherKey{XorID: key.XorID, Xor: key.Xor}},
+		{"key.rsa_id", CipherKey{RSAID: key.RSAID, RsaPrivate: key.RsaPrivate}},
+	}
+	for _, ref := range refs {
+		if err := ref.probe.resolve(store); err != nil {
+			diags = append(diags, Diagnostic{ref.path, SeverityError, err.Error()})
+		}
+	}
+	return diags
+}
+
+// hasKey 配置中是否提供了某类密钥(解析错误由 lintKey 单独报告)
+func hasKey(key CipherKey, kind KeyKind) bool {
+	switch kind {
+	case KeyAES:
+		return key.AES != "" || key.AESID != "" || len(key.AESKey) > 0
+	case KeyXor:
+		return key.Xor != "" || key.XorID != "" || len(key.XorKey) > 0
+	case KeyRSAPublic:
+		// 未配置公钥时使用私钥中的公钥加密
+		return key.RsaPublic != "" || key.RSAID != "" || key.RsaPublicKey != nil || hasKey(key, KeyRSAPrivate)
+	case KeyRSAPrivate:
+		return key.RsaPrivate != "" || key.RSAID != "" || key.RsaPrivateKey != nil
+	}
+	return false
+}
+
+// lintChainKeys 检查加密链中每个编解码器所需的密钥是否已配置
+func lintChainKeys(path, chain string, key CipherKey) []Diagnostic {
+	if strings.TrimSpace(chain) == "" {
+		return nil
+	}
+	var diags []Diagnostic
+	for i, name := range strings.Split(chain, chainSeparator) {
+		codec, ok := GetCodec(strings.TrimSpace(name))
+		if !ok {
+			continue
+		}
+		for _, kind := range codec.RequiredKeys() {
+			if !hasKey(key, kind) {
+				diags = append(diags, Diagnostic{fmt.Sprintf("%s[%d]", path, i), SeverityError,
+					fmt.Sprintf("%s 需要配置 key.%s", codec.Name(), kind)})
+			}
+		}
+	}
+	return diags
+}
+
+// lintPadding 检查填充与最外层编码输出是否冲突
+// 填充紧邻载荷的字符若属于编码字符集，服务端无法按字符边界切分出载荷
+func lintPadding(section, chain, front, back string) []Diagnostic {
+	codecs, err := ParseCodecChain(chain)
+	if err != nil || len(codecs) == 0 {
+		return nil
+	}
+	outer, ok := codecs[len(codecs)-1].(TextCodec)
+	if !ok || outer.Alphabet() == "" {
+		return nil
+	}
+	alphabet := outer.Alphabet()
+	var diags []Diagnostic
+	if front != "" && strings.ContainsRune(alphabet, rune(front[len(front)-1])) {
+		diags = append(diags, Diagnostic{section + ".front_padding", SeverityWarning,
+			fmt.Sprintf("结尾字符 %q 与 %s 编码输出冲突", front[len(front)-1], codecs[len(codecs)-1].Name())})
+	}
+	if back != "" && strings.ContainsRune(alphabet, rune(back[0])) {
+		diags = append(diags, Diagnostic{section + ".back_padding", SeverityWarning,
+			fmt.Sprintf("起始字符 %q 与 %s 编码输出冲突", back[0], codecs[len(codecs)-1].Name())})
+	}
+	return diags
+}
+
+func lintBasic(basic C2Basic) []Diagnostic {
+	var diags []Diagnostic
+	for i, proxy := range basic.Proxy {
+		if proxy == core.ProxyDirect {
+			continue
+		}
+		if _, err := core.ParseProxyURL(proxy); err != nil {
+			diags = append(diags, Diagnostic{fmt.Sprintf("basic.proxy[%d]", i), SeverityError, err.Error()})
+		}
+	}
+	if err := basic.TLS.Validate(); err != nil {
+		diags = append(diags, Diagnostic{"basic.tls", SeverityError, err.Error()})
+	}
+	files := []struct{ name, path string }{
+		{"ca_file", basic.TLS.CAFile},
+		{"cert_file", basic.TLS.CertFile},
+		{"key_file", basic.TLS.KeyFile},
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file.path); file.path != "" && err != nil {
+			diags = append(diags, Diagnostic{"basic.tls." + file.name, SeverityError, fmt.Sprintf("无法读取文件: %v", err)})
+		}
+	}
+	if limit := basic.RateLimit; limit.Rate < 0 || limit.Burst < 0 || limit.MaxConcurrent < 0 || limit.Spread < 0 {
+		diags = append(diags, Diagnostic{"basic.rate_limit", SeverityError, "限速配置不能为负数"})
+	}
+	if basic.TLS.InsecureSkipVerify && len(basic.TLS.PinSHA256) == 0 {
+		diags = append(diags, Diagnostic{"basic.tls.insecure_skip_verify", SeverityWarning, "跳过证书校验且未设置指纹，连接可能被中间人劫持"})
+	}
+	return diags
+}
@@ -0,0 +1,73 @@
+package c2
+
+import "testing"
+
+func TestLintReportsAllProblems(t *testing.T) {
+	data := []byte(`
+name: broken
+request:
+  method: POST
+  encode_chain: xor->rot13->base64
+  front_padding: "data="
+  condition:
+    - type: Query
+      value: a=b
+response:
+  encode_chain: rsa
+basic:
+  proxy:
+    - ftp://127.0.0.1:21
+`)
+	diags := LintBytes(data)
+	if !HasErrors(diags) {
+		t.Fatalf("expected errors, got %v", diags)
+	}
+	want := map[string]Severity{
+		"request.condition[0]":     SeverityError,
+		"request.encode_chain[0]":  SeverityError, // xor 缺少密钥
+		"request.encode_chain[1]":  SeverityError, // 未注册
+		"response.encode_chain[0]": SeverityError, // rsa 缺少私钥
+		"basic.proxy[0]":           SeverityError,
+	}
+	got := make(map[string]Severity)
+	for _, d := range diags {
+		got[d.Path] = d.Severity
+	}
+	for path, severity := range want {
+		if got[path] != severity {
+			t.Errorf("%s: got %q, want %q (all: %v)", path, got[path], severity, diags)
+		}
+	}
+}
+
+func TestLintPaddingCollision(t *testing.T) {
+	diags := Lint(C2Yaml{
+		Name: "padding",
+		Request: C2Request{
+			Method:       "POST",
+			EncodeChain:  "base64",
+			FrontPadding: "abc",
+			BackPadding:  "&x=1",
+		},
+	})
+	if HasErrors(diags) {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	if len(diags) != 1 || diags[0].Path != "request.front_padding" {
+		t.Fatalf("expected front_padding warning, got %v", diags)
+	}
+}
+
+func TestLintFormPayloadForGeneratedShell(t *testing.T) {
+	conf := C2Yaml{
+		Name:    "form",
+		Request: C2Request{Method: "POST", EncodeChain: "base64", Payload: Payload{Location: PayloadForm, Name: "pass"}},
+	}
+	var warned bool
+	for _, d := range LintWithStore(conf, nil) {
+		warned = warned || (d.Path == "request.payload.location" && d.Severity == SeverityWarning)
+	}
+	if !warned {
+		t.Fatal("expected a warning for an encoded form payload")
+	}
+}
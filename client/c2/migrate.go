@@ -0,0 +1,184 @@
+package c2
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置版本迁移：旧版本配置在内存中逐级升级到当前版本，可选择写回文件
+
+// CurrentVersion 当前配置版本，未设置 version 的配置视为版本1
+const CurrentVersion = 3
+
+// Migration 从 From 升级到 From+1
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(root *yaml.Node) error
+}
+
+// migrations 按版本顺序排列的迁移链
+var migrations = []Migration{
+	{
+		From:        1,
+		Description: "request.user_agent_list 更名为 request.user_agents",
+		Apply: func(root *yaml.Node) error {
+			return renameKey(mappingValue(root, "request"), "user_agent_list", "user_agents")
+		},
+	},
+	{
+		From:        2,
+		Description: "key.rsa_public/rsa_private 由Base64编码的PEM正文改为PEM正文",
+		Apply: func(root *yaml.Node) error {
+			key := mappingValue(root, "key")
+			for _, name := range []string{"rsa_public", "rsa_private"} {
+				if node := mappingValue(key, name); node != nil {
+					if body, ok := legacyRSAKey(node.Value); ok {
+						node.Value = body
+					}
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// MigrateNode 将配置文档升级到当前版本，返回原版本与执行过的迁移说明
+func MigrateNode(root *yaml.Node) (int, []string, error) {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return 0, nil, fmt.Errorf("配置文件根节点必须是映射")
+	}
+	version := 1
+	if node := mappingValue(root, "version"); node != nil {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil || v < 1 {
+			return 0, nil, fmt.Errorf("第%d行: 无效的配置版本: %s", node.Line, node.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return version, nil, fmt.Errorf("配置版本 %d 高于当前支持的版本 %d，请升级客户端", version, CurrentVersion)
+	}
+
+	from := version
+	var applied []string
+	for _, migration := range migrations {
+		if migration.From != version {
+			continue
+		}
+		if err := migration.Apply(root); err != nil {
+			return from, applied, fmt.Errorf("版本 %d -> %d 迁移失败: %v", version, version+1, err)
+		}
+		applied = append(applied, fmt.Sprintf("v%d -> v%d: %s", version, version+1, migration.Description))
+		version++
+	}
+	if from != CurrentVersion {
+		setVersion(root, CurrentVersion)
+	}
+	return from, applied, nil
+}
+
+// LoadProfile 解析配置：迁移到当前版本后严格解码，未知字段返回错误
+// 返回值 migrated 为执行过的迁移说明，为空表示已是当前版本
+func LoadProfile(data []byte) (profile C2Yaml, migrated []string, err error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return profile, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return profile, nil, fmt.Errorf("配置文件为空")
+	}
+	if _, migrated, err = MigrateNode(&doc); err != nil {
+		return profile, migrated, err
+	}
+	profile, err = decodeProfile(doc.Content[0])
+	return profile, migrated, err
+}
+
+// decodeProfile 检查未知字段后严格解码
+func decodeProfile(root *yaml.Node) (C2Yaml, error) {
+	var profile C2Yaml
+	if diags := unknownFields(root); HasErrors(diags) {
+		return profile, firstError(diags)
+	}
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return profile, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(out))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&profile)
+	return profile, err
+}
+
+// MigrateBytes 迁移配置并返回新的YAML内容(保留注释)，已是当前版本时返回 nil
+func MigrateBytes(data []byte) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("配置文件为空")
+	}
+	from, migrated, err := MigrateNode(&doc)
+	if err != nil || from == CurrentVersion {
+		return nil, migrated, err
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, migrated, err
+	}
+	return buf.Bytes(), migrated, encoder.Close()
+}
+
+// mappingValue 返回映射中 key 对应的值节点
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// renameKey 重命名映射中的键，新旧键同时存在时返回错误
+func renameKey(node *yaml.Node, from, to string) error {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != from {
+			continue
+		}
+		if mappingValue(node, to) != nil {
+			return fmt.Errorf("第%d行: %s 与 %s 不能同时存在", node.Content[i].Line, from, to)
+		}
+		node.Content[i].Value = to
+	}
+	return nil
+}
+
+// setVersion 设置版本号，不存在时插入到文档开头
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(root, "version"); node != nil {
+		node.Value = value
+		node.Tag = "!!int"
+		return
+	}
+	root.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, root.Content...)
+}
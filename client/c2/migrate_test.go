@@ -0,0 +1,106 @@
+package c2
+
+import (
+	"caffeine/core"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const legacyProfile = `# legacy profile
+name: legacy
+request:
+  method: POST
+  encode_chain: base64
+  user_agent_list:
+    - curl/8.0
+response:
+  encode_chain: base64
+`
+
+func TestLoadProfileMigratesLegacy(t *testing.T) {
+	profile, migrated, err := LoadProfile([]byte(legacyProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 2 || profile.Version != CurrentVersion {
+		t.Fatalf("expected two migrations to v%d, got %v (v%d)", CurrentVersion, migrated, profile.Version)
+	}
+	if len(profile.Request.UserAgents) != 1 || profile.Request.UserAgents[0] != "curl/8.0" {
+		t.Fatalf("user agents lost during migration: %v", profile.Request.UserAgents)
+	}
+
+	req, err := NewRequestHandler(profile).Handler(&core.Session{Target: core.Target{ShellURL: "http://127.0.0.1/"}}, []byte("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Headers["User-Agent"] != "curl/8.0" {
+		t.Fatalf("user agent not applied: %q", req.Headers["User-Agent"])
+	}
+
+	out, _, err := MigrateBytes([]byte(legacyProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "version: 3") || !strings.Contains(string(out), "user_agents:") ||
+		!strings.Contains(string(out), "# legacy profile") {
+		t.Fatalf("unexpected rewrite:\n%s", out)
+	}
+	if out, _, _ := MigrateBytes(out); out != nil {
+		t.Fatal("current profile should not be rewritten")
+	}
+}
+
+func TestLoadProfileUnknownFields(t *testing.T) {
+	_, _, err := LoadProfile([]byte("version: 2\nrequest:\n  method: POST\n  encode_chian: base64\n"))
+	if err == nil || !strings.Contains(err.Error(), "encode_chain") || !strings.Contains(err.Error(), "request.encode_chian") {
+		t.Fatalf("expected suggestion for misspelled key, got %v", err)
+	}
+	if _, _, err := LoadProfile([]byte("version: 9\n")); err == nil {
+		t.Fatal("expected newer version to be rejected")
+	}
+	if _, _, err := LoadProfile([]byte("version: 2\nkey:\n  aeskey: abc\n")); err == nil {
+		t.Fatal("runtime key fields must not be settable")
+	}
+}
+
+func TestMigrateLegacyRSAKey(t *testing.T) {
+	data, err := os.ReadFile("../../profiles/c2.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var current struct {
+		Key struct {
+			RsaPublic string `yaml:"rsa_public"`
+		} `yaml:"key"`
+	}
+	if err := yaml.Unmarshal(data, &current); err != nil || current.Key.RsaPublic == "" {
+		t.Fatalf("rsa_public not found in profile: %v", err)
+	}
+	legacy := base64.StdEncoding.EncodeToString([]byte(current.Key.RsaPublic))
+	profile := "version: 2\nresponse:\n  encode_chain: rsa\nkey:\n  rsa_public: " + legacy + "\n"
+
+	// 旧格式在迁移前后都能解析
+	if _, err := parseRSAPublicKey(legacy); err != nil {
+		t.Fatalf("legacy key rejected: %v", err)
+	}
+	loaded, migrated, err := LoadProfile([]byte(profile))
+	if err != nil || len(migrated) != 1 || loaded.Key.RsaPublicKey == nil {
+		t.Fatalf("legacy profile not migrated: %v %v", migrated, err)
+	}
+	out, _, err := MigrateBytes([]byte(profile))
+	if err != nil || !strings.Contains(string(out), "rsa_public: "+current.Key.RsaPublic) {
+		t.Fatalf("unexpected rewrite (%v):\n%s", err, out)
+	}
+
+	warned := false
+	for _, d := range LintBytes([]byte(strings.Replace(profile, "version: 2", "version: 3", 1))) {
+		warned = warned || (d.Path == "key.rsa_public" && d.Severity == SeverityWarning)
+	}
+	if !warned {
+		t.Fatal("expected legacy key warning")
+	}
+}
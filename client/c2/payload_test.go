@@ -0,0 +1,34 @@
+package c2
+
+import (
+	"caffeine/core"
+	"testing"
+)
+
+func TestPayloadFieldFromPassword(t *testing.T) {
+	conf := C2Yaml{
+		Request: C2Request{
+			Method: "POST", EncodeChain: "base64",
+			Headers: []string{"Content-Type:application/json"},
+			Payload: Payload{Location: PayloadForm, Name: "data"},
+		},
+		Response: C2Response{EncodeChain: "base64"},
+	}
+	session := &core.Session{Target: core.Target{ShellURL: "http://127.0.0.1/shell.php", Password: "pass"}}
+	req, err := NewRequestHandler(conf).Handler(session, []byte("phpinfo();"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Body) != "pass=cGhwaW5mbygpOw%3D%3D" {
+		t.Fatalf("unexpected form body: %s", req.Body)
+	}
+	if req.Headers["Content-Type"] != "application/x-www-form-urlencoded" {
+		t.Fatalf("unexpected content type: %s", req.Headers["Content-Type"])
+	}
+
+	session.Target.Password = ""
+	conf.Request.Payload = Payload{Location: PayloadQuery}
+	if _, err := NewRequestHandler(conf).Handler(session, []byte("phpinfo();")); err == nil {
+		t.Fatal("expected missing field name to fail")
+	}
+}
@@ -3,14 +3,17 @@ package c2
 import (
 	"caffeine/core"
 	"container/list"
-	"encoding/base64"
-	"errors"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
 	"strings"
 )
 
 type RequestHandler struct {
 	config      C2Yaml
-	CryptoChain *list.List //加密链，链表结构
+	CryptoChain *list.List //加密链，链表结构，元素为Codec
+	chainErr    error      //加密链解析错误
 }
 
 func NewRequestHandler(config C2Yaml) *RequestHandler {
@@ -23,33 +26,110 @@ func NewRequestHandler(config C2Yaml) *RequestHandler {
 }
 
 func (h *RequestHandler) parseC2Config(config C2Yaml) {
-	if config.Request.EncodeChain != "" {
-		chain := list.New()
-		split := strings.Split(config.Request.EncodeChain, "->")
-		for _, ciper := range split {
-			chain.PushBack(ciper)
+	chain := list.New()
+	codecs, err := ParseCodecChain(config.Request.EncodeChain)
+	if err != nil {
+		h.chainErr = err
+	}
+	for _, codec := range codecs {
+		chain.PushBack(codec)
+	}
+	h.CryptoChain = chain
+}
+
+func (h *RequestHandler) Handler(session *core.Session, data []byte) (*core.HttpRequest, error) {
+	return h.HandlerContext(context.Background(), session, data)
+}
+
+// HandlerContext 构建请求并绑定上下文，上下文取消后请求随之中止
+func (h *RequestHandler) HandlerContext(ctx context.Context, session *core.Session, data []byte) (*core.HttpRequest, error) {
+	req, key, err := h.newRequest(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	req.Plaintext = data
+
+	// Apply encryption chain
+	mainData := data
+	for e := h.CryptoChain.Front(); e != nil; e = e.Next() {
+		codec := e.Value.(Codec)
+		mainData, err = codec.Encode(mainData, &key)
+		if err != nil {
+			return nil, fmt.Errorf("%s encode: %w", codec.Name(), err)
 		}
-		h.CryptoChain = chain
 	}
 
+	// Build final payload with padding
+	front := h.config.Request.FrontPadding
+	back := h.config.Request.BackPadding
+	payload := make([]byte, len(front)+len(mainData)+len(back))
+	offset := 0
+	offset += copy(payload[offset:], front)
+	offset += copy(payload[offset:], mainData)
+	copy(payload[offset:], back)
+
+	// Place the payload in the body, a form field or a query parameter
+	settings := h.config.Request.Payload
+	if err := settings.apply(req, settings.fieldName(session.Target), payload); err != nil {
+		return nil, err
+	}
+
+	return req, nil
 }
 
-func (h *RequestHandler) Handler(session *core.Session, data []byte) (*core.HttpRequest, error) {
+// StreamHandler 流式构建请求，请求体在发送时边读取 data 边编码
+// 载荷只能位于请求体(body/form/multipart)，不经过完整的内存拷贝
+func (h *RequestHandler) StreamHandler(session *core.Session, data io.Reader) (*core.HttpRequest, error) {
+	return h.StreamHandlerContext(context.Background(), session, data)
+}
+
+// StreamHandlerContext 流式构建请求并绑定上下文
+func (h *RequestHandler) StreamHandlerContext(ctx context.Context, session *core.Session, data io.Reader) (*core.HttpRequest, error) {
+	req, key, err := h.newRequest(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	settings := h.config.Request.Payload
+	name := settings.fieldName(session.Target)
+	body, err := settings.stream(req, name, func(w io.Writer) error {
+		if _, err := io.WriteString(w, h.config.Request.FrontPadding); err != nil {
+			return err
+		}
+		encoder, err := NewEncodeWriter(h.codecs(), w, &key)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(encoder, data); err != nil {
+			return err
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, h.config.Request.BackPadding)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.BodyReader = body
+	return req, nil
+}
+
+// newRequest 创建请求并设置请求头、条件与会话Cookie，返回本次请求使用的密钥
+func (h *RequestHandler) newRequest(ctx context.Context, session *core.Session) (*core.HttpRequest, CipherKey, error) {
 	// Create new HTTP request with ID
 	req := core.NewHttpRequest()
+	req.SetContext(ctx)
+	req.SessionID = session.ID
+	req.ShellID = session.Target.ID
 	req.URL = session.Target.ShellURL
 	req.Method = h.config.Request.Method
 	req.Headers = make(map[string]string)
 
-	// Apply encryption chain
-	mainData := data
-	var err error
-	for e := h.CryptoChain.Front(); e != nil; e = e.Next() {
-		mainData, err = h.crypto(core.CryptoAlgorithm(e.Value.(string)), mainData)
-		if err != nil {
-			return nil, err
-		}
+	if h.chainErr != nil {
+		return nil, CipherKey{}, h.chainErr
 	}
+	key := sessionCipherKey(h.config.Key, session)
 
 	// Add headers from config
 	if headers := h.config.Request.Headers; headers != nil {
@@ -61,38 +141,62 @@ func (h *RequestHandler) Handler(session *core.Session, data []byte) (*core.Http
 		}
 	}
 
-	// Build final request body with padding
-	front := h.config.Request.FrontPadding
-	back := h.config.Request.BackPadding
-	body := make([]byte, len(front)+len(mainData)+len(back))
-	offset := 0
-	offset += copy(body[offset:], front)
-	offset += copy(body[offset:], mainData)
-	copy(body[offset:], back)
-	req.Body = body
+	// TLS settings of the shell override the profile
+	if settings := h.config.Basic.TLS.Merge(session.Target.TLS); !settings.IsZero() {
+		req.TLS = &settings
+	}
 
-	return req, nil
+	// Per-profile proxy overrides the global proxy rules
+	if proxies := h.config.Basic.Proxy; len(proxies) > 0 {
+		req.Proxy = proxies[rand.Intn(len(proxies))]
+	}
+
+	// Rate limits of the profile and the circuit breaker apply to each shell separately
+	if session.Target.ID != 0 {
+		req.Target = core.ShellKey(session.Target.ID)
+		if limit := h.config.Basic.RateLimit; !limit.IsZero() {
+			req.RateLimit = &limit
+		}
+	}
+
+	// Traffic of the profile or the shell may be excluded from the cache
+	req.NoCache = h.config.Basic.NoCache || session.Target.NoCache
+
+	// Pick a random User-Agent from the profile
+	if agents := h.config.Request.UserAgents; len(agents) > 0 {
+		req.Headers["User-Agent"] = agents[rand.Intn(len(agents))]
+	}
+
+	// Apply request conditions (query parameter, cookie, header, path suffix)
+	for _, condition := range h.config.Request.Condition {
+		if err := condition.Apply(req); err != nil {
+			return nil, CipherKey{}, err
+		}
+	}
+
+	// Carry the server side session holding the negotiated key
+	if session != nil && session.SessionToken != "" {
+		cookie := ReqCondition{Type: ConditionCookie, Value: SessionCookieName + "=" + session.SessionToken}
+		if err := cookie.Apply(req); err != nil {
+			return nil, CipherKey{}, err
+		}
+	}
+	return req, key, nil
 }
 
-func (h *RequestHandler) crypto(CryptoAlgorithm core.CryptoAlgorithm, data []byte) ([]byte, error) {
-	switch CryptoAlgorithm {
-	case core.AES:
-		return core.AESEncode(data, h.config.Key.AESKey)
-	case core.Base64:
-		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
-		base64.StdEncoding.Encode(encoded, data)
-		return encoded, nil
-	case core.Hex:
-		hex := core.ToHex(data)
-		return hex, nil
-	case core.Xor:
-		crypto := core.XorCrypto(data, h.config.Key.XorKey)
-		return crypto, nil
-	case core.RSA:
-		//使用私钥加密，防止webshell端被截获
-		return core.SignWithRSA(h.config.Key.RsaPrivateKey, data)
-	default:
-		return nil, errors.New("crypto algorithm not support")
-	}
-	return data, nil
+// codecs 返回加密链中的编解码器
+func (h *RequestHandler) codecs() []Codec {
+	codecs := make([]Codec, 0, h.CryptoChain.Len())
+	for e := h.CryptoChain.Front(); e != nil; e = e.Next() {
+		codecs = append(codecs, e.Value.(Codec))
+	}
+	return codecs
+}
+
+// sessionCipherKey 会话已协商密钥时使用会话密钥
+func sessionCipherKey(key CipherKey, session *core.Session) CipherKey {
+	if session == nil || len(session.SessionKey) == 0 {
+		return key
+	}
+	return key.WithSessionKey(session.SessionKey)
 }
@@ -1,17 +1,18 @@
 package c2
 
 import (
+	"bytes"
 	"caffeine/core"
 	"container/list"
-	"encoding/base64"
-	"errors"
 	"fmt"
+	"io"
 	"strings"
 )
 
 type ResponseHandler struct {
 	config      C2Yaml
-	CryptoChain *list.List //解密链，链表结构
+	CryptoChain *list.List //解密链，链表结构，元素为Codec
+	chainErr    error      //解密链解析错误
 }
 
 func NewResponseHandler(config C2Yaml) *ResponseHandler {
@@ -23,55 +24,143 @@ func NewResponseHandler(config C2Yaml) *ResponseHandler {
 	return handler
 }
 
+// 错误信息中保留的响应体长度
+const excerptLength = 256
+
+// UnexpectedResponseError 响应不符合C2配置（例如404页面、WAF拦截页）
+type UnexpectedResponseError struct {
+	StatusCode int    // 原始状态码
+	Reason     string // 不匹配的原因
+	Excerpt    []byte // 响应体片段
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("unexpected response (status %d): %s; body: %q", e.StatusCode, e.Reason, e.Excerpt)
+}
+
+func newUnexpectedResponse(response *core.HttpResponse, format string, args ...interface{}) *UnexpectedResponseError {
+	return &UnexpectedResponseError{
+		StatusCode: response.StatusCode(),
+		Reason:     fmt.Sprintf(format, args...),
+		Excerpt:    excerpt(response.Body),
+	}
+}
+
+// validate 校验状态码、响应头以及填充数据
+func (h *ResponseHandler) validate(response *core.HttpResponse) error {
+	if err := h.validateHead(response); err != nil {
+		return err
+	}
+	conf := h.config.Response
+	body := response.Body
+	if len(conf.FrontPadding)+len(conf.BackPadding) > len(body) {
+		return newUnexpectedResponse(response, "padding length exceeds body length")
+	}
+	if !bytes.HasPrefix(body, []byte(conf.FrontPadding)) {
+		return newUnexpectedResponse(response, "front padding mismatch")
+	}
+	if !bytes.HasSuffix(body, []byte(conf.BackPadding)) {
+		return newUnexpectedResponse(response, "back padding mismatch")
+	}
+	return nil
+}
+
+// validateHead 校验状态码与响应头
+func (h *ResponseHandler) validateHead(response *core.HttpResponse) error {
+	conf := h.config.Response
+	if conf.Code != 0 && response.StatusCode() != conf.Code {
+		return newUnexpectedResponse(response, "status code %d, expected %d", response.StatusCode(), conf.Code)
+	}
+	for _, header := range conf.Headers {
+		split := strings.SplitN(header, ":", 2)
+		if len(split) != 2 {
+			continue
+		}
+		name, expected := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+		value := response.Headers.Get(name)
+		if value == "" {
+			return newUnexpectedResponse(response, "missing header %s", name)
+		}
+		if !strings.Contains(value, expected) {
+			return newUnexpectedResponse(response, "header %s is %q, expected %q", name, value, expected)
+		}
+	}
+	return nil
+}
+
 func (h *ResponseHandler) Handler(session *core.Session, response *core.HttpResponse) ([]byte, error) {
 	if response == nil {
 		return nil, fmt.Errorf("response is nil")
 	}
+	if err := h.validate(response); err != nil {
+		return nil, err
+	}
 	body := response.Body
-	fmt.Println(string(body))
 	//去除填充数据
-	if len(h.config.Response.FrontPadding)+len(h.config.Response.BackPadding) > len(body) {
-		return nil, fmt.Errorf("Padding length exceeds body length")
-	}
 	mainData := body[len(h.config.Response.FrontPadding) : len(body)-len(h.config.Response.BackPadding)]
+	if h.chainErr != nil {
+		return nil, h.chainErr
+	}
+	key := sessionCipherKey(h.config.Key, session)
 	var err error
 	for e := h.CryptoChain.Front(); e != nil; e = e.Next() {
-		mainData, err = h.crypto(core.CryptoAlgorithm(e.Value.(string)), mainData)
+		codec := e.Value.(Codec)
+		mainData, err = codec.Decode(mainData, &key)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s decode: %w", codec.Name(), err)
 		}
 	}
 	return mainData, nil
 }
 
-func (h *ResponseHandler) parseC2Config(config C2Yaml) {
-	if config.Request.EncodeChain != "" {
-		chain := list.New()
-		split := strings.Split(config.Response.EncodeChain, "->")
-		for _, ciper := range split {
-			//往前差入，逆序处理
-			chain.PushFront(ciper)
-		}
-		h.CryptoChain = chain
+// StreamHandler 流式解析响应，返回边读取边解码的明文，调用方负责关闭
+// 填充在读取过程中校验，尾部填充不匹配时在读到末尾时返回错误
+func (h *ResponseHandler) StreamHandler(session *core.Session, response *core.HttpResponse) (io.ReadCloser, error) {
+	if response == nil || response.BodyReader == nil {
+		return nil, fmt.Errorf("response stream is nil")
+	}
+	if err := h.validateHead(response); err != nil {
+		response.BodyReader.Close()
+		return nil, err
+	}
+	if h.chainErr != nil {
+		response.BodyReader.Close()
+		return nil, h.chainErr
 	}
+	key := sessionCipherKey(h.config.Key, session)
+	body := newPaddingReader(response.BodyReader, h.config.Response.FrontPadding, h.config.Response.BackPadding)
+	decoded, err := NewDecodeReader(h.codecs(), body, &key)
+	if err != nil {
+		response.BodyReader.Close()
+		return nil, err
+	}
+	return &streamReadCloser{Reader: decoded, Closer: response.BodyReader}, nil
 }
 
-func (h *ResponseHandler) crypto(CryptoAlgorithm core.CryptoAlgorithm, data []byte) ([]byte, error) {
-	switch CryptoAlgorithm {
-	case core.AES:
-		return core.AESDecode(data, h.config.Key.AESKey)
-	case core.Base64:
-		return base64.StdEncoding.DecodeString(string(data))
-	case core.Hex:
-		return core.UnHex(data)
-	case core.Xor:
-		crypto := core.XorCrypto(data, h.config.Key.XorKey)
-		return crypto, nil
-	case core.RSA:
-		//使用私钥解密
-		return core.DecryptPrivateRSA(h.config.Key.RsaPrivateKey, data)
-	default:
-		return nil, errors.New("crypto algorithm not support")
-	}
-	return data, nil
+// codecs 按配置顺序返回加密链中的编解码器
+func (h *ResponseHandler) codecs() []Codec {
+	codecs := make([]Codec, 0, h.CryptoChain.Len())
+	for e := h.CryptoChain.Back(); e != nil; e = e.Prev() {
+		codecs = append(codecs, e.Value.(Codec))
+	}
+	return codecs
+}
+
+// streamReadCloser 解码后的数据流，关闭时关闭原始响应体
+type streamReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (h *ResponseHandler) parseC2Config(config C2Yaml) {
+	chain := list.New()
+	codecs, err := ParseCodecChain(config.Response.EncodeChain)
+	if err != nil {
+		h.chainErr = err
+	}
+	for _, codec := range codecs {
+		//往前插入，逆序处理
+		chain.PushFront(codec)
+	}
+	h.CryptoChain = chain
 }
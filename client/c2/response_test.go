@@ -0,0 +1,86 @@
+package c2
+
+import (
+	"caffeine/core"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func testResponseConfig() C2Yaml {
+	return C2Yaml{
+		Response: C2Response{
+			Code:         200,
+			FrontPadding: `{"data":"`,
+			BackPadding:  `"}`,
+			EncodeChain:  "base64",
+			Headers:      []string{"Content-Type:application/json"},
+		},
+	}
+}
+
+func TestResponseHandlerAccept(t *testing.T) {
+	headers := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	response := core.NewHttpResponse(200, headers, []byte(`{"data":"aGVsbG8="}`))
+	data, err := NewResponseHandler(testResponseConfig()).Handler(nil, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected data: %s", data)
+	}
+}
+
+func TestResponseHandlerUnexpected(t *testing.T) {
+	json := http.Header{"Content-Type": []string{"application/json"}}
+	cases := map[string]*core.HttpResponse{
+		"status":  core.NewHttpResponse(404, json, []byte(`<html>not found</html>`)),
+		"header":  core.NewHttpResponse(200, http.Header{"Content-Type": []string{"text/html"}}, []byte(`{"data":"aGVsbG8="}`)),
+		"padding": core.NewHttpResponse(200, json, []byte(`<html>blocked by waf</html>`)),
+	}
+	for name, response := range cases {
+		_, err := NewResponseHandler(testResponseConfig()).Handler(nil, response)
+		var unexpected *UnexpectedResponseError
+		if !errors.As(err, &unexpected) {
+			t.Fatalf("%s: expected UnexpectedResponseError, got %v", name, err)
+		}
+		if unexpected.StatusCode != response.StatusCode() || len(unexpected.Excerpt) == 0 {
+			t.Fatalf("%s: missing status or excerpt: %+v", name, unexpected)
+		}
+	}
+}
+
+func TestResponseHandlerWrapsCodecError(t *testing.T) {
+	json := http.Header{"Content-Type": []string{"application/json"}}
+	response := core.NewHttpResponse(200, json, []byte(`{"data":"not*base64"}`))
+	_, err := NewResponseHandler(testResponseConfig()).Handler(nil, response)
+	var corrupt base64.CorruptInputError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("codec error lost from chain: %v", err)
+	}
+}
+
+func TestResponseHandlerIntegrity(t *testing.T) {
+	conf := testResponseConfig()
+	conf.Response.EncodeChain = "aes-gcm->base64"
+	conf.Key = streamTestKey(t)
+	response, err := emulateServerEncode(conf.Response, []byte("uid=0(root)"), &conf.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewResponseHandler(conf).Handler(nil, response)
+	if err != nil || string(data) != "uid=0(root)" {
+		t.Fatalf("unexpected data %q: %v", data, err)
+	}
+
+	// 篡改密文中的一个字节
+	body := response.Body
+	sealed, _ := base64.StdEncoding.DecodeString(string(body[len(conf.Response.FrontPadding) : len(body)-len(conf.Response.BackPadding)]))
+	sealed[len(sealed)/2] ^= 0xff
+	tampered := conf.Response.FrontPadding + base64.StdEncoding.EncodeToString(sealed) + conf.Response.BackPadding
+	response = core.NewHttpResponse(200, response.Headers, []byte(tampered))
+	if _, err := NewResponseHandler(conf).Handler(nil, response); !errors.Is(err, core.ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity, got %v", err)
+	}
+}
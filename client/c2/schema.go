@@ -0,0 +1,74 @@
+package c2
+
+import (
+	"caffeine/core"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RequestMethods 支持的请求方法
+var RequestMethods = []string{"GET", "POST", "PUT", "DELETE"}
+
+// ProfileSchema 生成C2配置的 JSON Schema，可选值取自当前注册的编解码器与条件类型
+func ProfileSchema() *core.Schema {
+	schema := core.ReflectSchema(C2Yaml{})
+	schema.Title = "caffeine c2 profile"
+	names := CodecNames()
+	for _, path := range [][]string{{"request", "encode_chain"}, {"response", "encode_chain"}} {
+		if node := schema.Property(path...); node != nil {
+			node.Pattern = codecChainPattern(names)
+			node.Description = "编解码链，使用 " + chainSeparator + " 连接，可选: " + strings.Join(names, ", ")
+			node.Examples = []interface{}{"hex->base64"}
+		}
+	}
+	if node := schema.Property("basic", "tls", "pin_sha256", "[]"); node != nil {
+		node.Pattern = `^([0-9a-fA-F]{2}:?){31}[0-9a-fA-F]{2}$`
+		node.Description = "证书SHA-256指纹(十六进制，可用冒号分隔)"
+	}
+	core.DescribeRateLimit(schema.Property("basic", "rate_limit"))
+	if node := schema.Property("version"); node != nil {
+		node.Default = CurrentVersion
+	}
+	schema.SetRange(1, CurrentVersion, "version").
+		SetOptionalRange(100, 599, "response", "code").
+		SetEnum(RequestMethods, "request", "method").
+		SetEnum(ConditionTypes, "request", "condition", "[]", "type").
+		SetEnum(PayloadLocations, "request", "payload", "location").
+		SetEnum([]string{"", KeyExchangeX25519}, "key", "exchange").
+		SetEnum(tlsVersions(), "basic", "tls", "min_version").
+		Describe("配置名称，为空时使用文件名", "name").
+		Describe("期望的响应状态码，0 表示不校验", "response", "code").
+		Describe("不将使用该配置的shell的请求记录到流量缓存", "basic", "no_cache").
+		Describe("继承的配置名称", "extends").
+		Describe("代理地址 scheme://[user:pass@]host:port，支持 "+strings.Join(core.ProxySchemes, "/")+"，direct 表示直连", "basic", "proxy").
+		Describe("每次请求随机选择一个 User-Agent", "request", "user_agents").
+		Describe("格式为 Name: Value", "request", "headers").
+		Describe("格式为 Name: Value", "response", "headers").
+		Describe("字段名，shell 设置了密码时以密码为准", "request", "payload", "name").
+		Describe("引用密钥库中的AES密钥，与 aes 互斥", "key", "aes_id").
+		Describe("引用密钥库中的Xor密钥，与 xor 互斥", "key", "xor_id").
+		Describe("引用密钥库中的RSA私钥，与 rsa_public/rsa_private 互斥", "key", "rsa_id").
+		Describe("会话密钥协商方式，需要 key.aes 用于认证，为空则一直使用静态密钥", "key", "exchange")
+	return schema
+}
+
+// tlsVersions 可选的最低TLS版本(已排序)
+func tlsVersions() []string {
+	versions := make([]string, 0, len(core.TLSVersions))
+	for version := range core.TLSVersions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// 编解码链的正则，允许为空
+func codecChainPattern(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	codec := `\s*(` + strings.Join(quoted, "|") + `)\s*`
+	return `^(` + codec + `(` + regexp.QuoteMeta(chainSeparator) + codec + `)*)?$`
+}
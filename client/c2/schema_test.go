@@ -0,0 +1,36 @@
+package c2
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestProfileSchema(t *testing.T) {
+	schema := ProfileSchema()
+	if schema.Property("key", "aes_key") != nil || schema.Property("key", "aes_id") == nil {
+		t.Fatal("schema should only contain yaml fields")
+	}
+	if got := len(schema.Property("request", "condition", "[]", "type").Enum); got != len(ConditionTypes) {
+		t.Fatalf("condition type enum = %d, want %d", got, len(ConditionTypes))
+	}
+	pattern := regexp.MustCompile(schema.Property("request", "encode_chain").Pattern)
+	for chain, want := range map[string]bool{
+		"":                true,
+		"hex->base64":     true,
+		"xor -> base64":   true,
+		"rot13->base64":   false,
+		"hex->":           false,
+		"base64->>base64": false,
+	} {
+		if pattern.MatchString(chain) != want {
+			t.Errorf("pattern match %q = %v, want %v", chain, !want, want)
+		}
+	}
+	// 0 表示不校验状态码
+	if code := schema.Property("response", "code"); len(code.AnyOf) != 2 || code.AnyOf[0].Enum[0] != 0 || code.Minimum != nil {
+		t.Fatalf("response.code should allow 0 or 100-599: %+v", code)
+	}
+	if _, err := schema.JSON(); err != nil {
+		t.Fatal(err)
+	}
+}
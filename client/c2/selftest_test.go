@@ -0,0 +1,105 @@
+package c2
+
+import (
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 测试用的有缺陷编解码器：解码时丢弃最后一个字节
+type lossyCodec struct{ invertCodec }
+
+func (lossyCodec) Name() string { return "lossy" }
+
+func (c lossyCodec) Decode(data []byte, key *CipherKey) ([]byte, error) {
+	out, err := c.invertCodec.Decode(data, key)
+	if len(out) > 0 {
+		out = out[:len(out)-1]
+	}
+	return out, err
+}
+
+func TestSelfTestSampleProfile(t *testing.T) {
+	data, err := os.ReadFile("../../profiles/c2.yaml")
+	if err != nil {
+		t.Skip(err)
+	}
+	var profile C2Yaml
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		t.Fatal(err)
+	}
+	for _, exchange := range []string{"", KeyExchangeX25519} {
+		profile.Key.Exchange = exchange
+		report := SelfTest(profile, []byte("echo 'hello';"))
+		if !report.OK() {
+			t.Fatalf("exchange %q: %+v", exchange, report.Stages)
+		}
+	}
+}
+
+func TestSelfTestReportsFailedStage(t *testing.T) {
+	if _, ok := GetCodec("lossy"); !ok {
+		MustRegisterCodec(lossyCodec{})
+	}
+	profile := C2Yaml{
+		Request:  C2Request{Method: "POST", EncodeChain: "base64"},
+		Response: C2Response{EncodeChain: "lossy->hex"},
+	}
+	report := SelfTest(profile, []byte("id"))
+	failed := report.Failed()
+	if failed == nil || failed.Name != StageResponse {
+		t.Fatalf("expected %s stage to fail, got %+v", StageResponse, report.Stages)
+	}
+
+	// 同名条件互相覆盖，服务端只能看到后一个
+	profile.Request.Condition = []ReqCondition{
+		{Type: ConditionHeader, Value: "X-Token=1"},
+		{Type: ConditionHeader, Value: "X-Token=2"},
+	}
+	if failed := SelfTest(profile, []byte("id")).Failed(); failed == nil || failed.Name != StageServerMatch {
+		t.Fatalf("expected %s stage to fail, got %+v", StageServerMatch, failed)
+	}
+}
+
+func TestSelfTestPayloadLocations(t *testing.T) {
+	for _, location := range PayloadLocations {
+		profile := C2Yaml{
+			Request: C2Request{
+				Method:       "POST",
+				EncodeChain:  "hex->base64",
+				FrontPadding: "{\"a\":\"",
+				BackPadding:  "\"}",
+				Payload:      Payload{Location: location, Name: "pass"},
+			},
+			Response: C2Response{EncodeChain: "base64"},
+		}
+		if report := SelfTest(profile, []byte("system('id');")); !report.OK() {
+			t.Fatalf("%s: %+v", location, report.Failed())
+		}
+	}
+}
+
+func TestKeyExchangeRequiresAESKey(t *testing.T) {
+	profile := C2Yaml{
+		Name:     "xor-only",
+		Request:  C2Request{Method: "POST", EncodeChain: "xor->base64"},
+		Response: C2Response{EncodeChain: "base64"},
+		Key:      CipherKey{Xor: "MTIzNDU2", XorKey: []byte("123456"), Exchange: KeyExchangeX25519},
+	}
+	// shell 只使用 $aeskey 认证，仅有 xor 密钥时无法协商
+	if failed := SelfTest(profile, []byte("id")).Failed(); failed == nil || failed.Name != StageKeyExchange {
+		t.Fatalf("expected %s stage to fail, got %+v", StageKeyExchange, failed)
+	}
+	var found bool
+	for _, d := range LintWithStore(profile, nil) {
+		found = found || (d.Path == "key.exchange" && d.Severity == SeverityError)
+	}
+	if !found {
+		t.Fatal("expected key.exchange error")
+	}
+	var key CipherKey
+	if err := yaml.Unmarshal([]byte("xor: MTIzNDU2\nexchange: x25519\n"), &key); err == nil {
+		t.Fatal("expected unmarshal error without key.aes")
+	}
+}
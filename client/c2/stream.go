@@ -0,0 +1,272 @@
+package c2
+
+import (
+	"bytes"
+	"caffeine/core"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// 流式编解码，用于大文件传输
+
+// StreamCodec 支持流式处理的编解码器
+// 未实现该接口的编解码器(如 aes-gcm、rsa)在流式链中会缓存完整数据后再处理
+type StreamCodec interface {
+	Codec
+	EncodeWriter(w io.Writer, key *CipherKey) (io.WriteCloser, error) // Close 时写出剩余数据，不关闭 w
+	DecodeReader(r io.Reader, key *CipherKey) (io.Reader, error)
+}
+
+// streamFuncCodec 支持流式处理的内置编解码器
+type streamFuncCodec struct {
+	*funcCodec
+	encodeWriter func(w io.Writer, key *CipherKey) (io.WriteCloser, error)
+	decodeReader func(r io.Reader, key *CipherKey) (io.Reader, error)
+}
+
+func (c *streamFuncCodec) EncodeWriter(w io.Writer, key *CipherKey) (io.WriteCloser, error) {
+	return c.encodeWriter(w, key)
+}
+
+func (c *streamFuncCodec) DecodeReader(r io.Reader, key *CipherKey) (io.Reader, error) {
+	return c.decodeReader(r, key)
+}
+
+// IsStreamable 加密链中的编解码器是否全部支持流式处理
+func IsStreamable(codecs []Codec) bool {
+	for _, codec := range codecs {
+		if _, ok := codec.(StreamCodec); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewEncodeWriter 按加密链顺序编码写入 w 的数据，Close 后 w 中为完整的编码结果
+func NewEncodeWriter(codecs []Codec, w io.Writer, key *CipherKey) (io.WriteCloser, error) {
+	writers := make([]io.WriteCloser, len(codecs))
+	var next io.Writer = w
+	// 最后一个编解码器最靠近输出端，从后往前构造
+	for i := len(codecs) - 1; i >= 0; i-- {
+		var err error
+		if stream, ok := codecs[i].(StreamCodec); ok {
+			writers[i], err = stream.EncodeWriter(next, key)
+		} else {
+			writers[i] = &bufferedEncoder{codec: codecs[i], key: key, w: next}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s encode: %w", codecs[i].Name(), err)
+		}
+		next = writers[i]
+	}
+	return &chainWriter{codecs: codecs, writers: writers, head: next}, nil
+}
+
+// NewDecodeReader 按加密链逆序解码 r 中的数据
+func NewDecodeReader(codecs []Codec, r io.Reader, key *CipherKey) (io.Reader, error) {
+	for i := len(codecs) - 1; i >= 0; i-- {
+		var err error
+		if stream, ok := codecs[i].(StreamCodec); ok {
+			r, err = stream.DecodeReader(r, key)
+		} else {
+			r = &bufferedDecoder{codec: codecs[i], key: key, r: r}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s decode: %w", codecs[i].Name(), err)
+		}
+	}
+	return r, nil
+}
+
+// chainWriter 关闭时从第一个编解码器开始依次关闭，保证剩余数据逐级写出
+type chainWriter struct {
+	codecs  []Codec
+	writers []io.WriteCloser
+	head    io.Writer
+}
+
+func (c *chainWriter) Write(p []byte) (int, error) {
+	return c.head.Write(p)
+}
+
+func (c *chainWriter) Close() error {
+	for i, w := range c.writers {
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("%s encode: %w", c.codecs[i].Name(), err)
+		}
+	}
+	return nil
+}
+
+// bufferedEncoder 不支持流式处理的编解码器，缓存全部数据后在 Close 时编码
+type bufferedEncoder struct {
+	codec Codec
+	key   *CipherKey
+	w     io.Writer
+	buf   bytes.Buffer
+}
+
+func (b *bufferedEncoder) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *bufferedEncoder) Close() error {
+	out, err := b.codec.Encode(b.buf.Bytes(), b.key)
+	if err != nil {
+		return err
+	}
+	_, err = b.w.Write(out)
+	return err
+}
+
+// bufferedDecoder 首次读取时读完全部数据并解码
+type bufferedDecoder struct {
+	codec   Codec
+	key     *CipherKey
+	r       io.Reader
+	decoded io.Reader
+}
+
+func (b *bufferedDecoder) Read(p []byte) (int, error) {
+	if b.decoded == nil {
+		data, err := io.ReadAll(b.r)
+		if err != nil {
+			return 0, err
+		}
+		out, err := b.codec.Decode(data, b.key)
+		if err != nil {
+			return 0, fmt.Errorf("%s decode: %w", b.codec.Name(), err)
+		}
+		b.decoded = bytes.NewReader(out)
+	}
+	return b.decoded.Read(p)
+}
+
+// nopWriteCloser 无需收尾的写入器
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// paddingReader 校验并去除首尾填充，尾部填充在读到EOF时校验
+type paddingReader struct {
+	r     io.Reader
+	front []byte
+	back  []byte
+	tail  []byte // 暂存的末尾数据，可能属于尾部填充
+	start bool
+	eof   bool
+}
+
+// newPaddingReader 去除流中的首尾填充
+func newPaddingReader(r io.Reader, front, back string) io.Reader {
+	return &paddingReader{r: r, front: []byte(front), back: []byte(back)}
+}
+
+func (p *paddingReader) Read(out []byte) (int, error) {
+	if !p.start {
+		p.start = true
+		head := make([]byte, len(p.front))
+		if _, err := io.ReadFull(p.r, head); err != nil || !bytes.Equal(head, p.front) {
+			return 0, fmt.Errorf("front padding mismatch")
+		}
+	}
+	for {
+		// 保留 len(back) 字节，其余数据可以返回
+		if n := len(p.tail) - len(p.back); n > 0 {
+			if n > len(out) {
+				n = len(out)
+			}
+			copy(out, p.tail[:n])
+			p.tail = p.tail[n:]
+			return n, nil
+		}
+		if p.eof {
+			if !bytes.Equal(p.tail, p.back) {
+				return 0, fmt.Errorf("back padding mismatch")
+			}
+			return 0, io.EOF
+		}
+		buf := make([]byte, 32*1024)
+		n, err := p.r.Read(buf)
+		p.tail = append(p.tail, buf[:n]...)
+		if err == io.EOF {
+			p.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// addStreamSupport 为内置编解码器补充流式实现
+func addStreamSupport() {
+	streamable := map[string]*streamFuncCodec{
+		string(core.Base64): {
+			encodeWriter: func(w io.Writer, _ *CipherKey) (io.WriteCloser, error) {
+				return base64.NewEncoder(base64.StdEncoding, w), nil
+			},
+			decodeReader: func(r io.Reader, _ *CipherKey) (io.Reader, error) {
+				return base64.NewDecoder(base64.StdEncoding, r), nil
+			},
+		},
+		string(core.Hex): {
+			encodeWriter: func(w io.Writer, _ *CipherKey) (io.WriteCloser, error) {
+				return nopWriteCloser{hex.NewEncoder(w)}, nil
+			},
+			decodeReader: func(r io.Reader, _ *CipherKey) (io.Reader, error) {
+				return hex.NewDecoder(r), nil
+			},
+		},
+		string(core.Xor): {
+			encodeWriter: func(w io.Writer, key *CipherKey) (io.WriteCloser, error) {
+				if len(key.XorKey) == 0 {
+					return nil, fmt.Errorf("xor 密钥未配置")
+				}
+				return nopWriteCloser{core.NewXorWriter(w, key.XorKey)}, nil
+			},
+			decodeReader: func(r io.Reader, key *CipherKey) (io.Reader, error) {
+				if len(key.XorKey) == 0 {
+					return nil, fmt.Errorf("xor 密钥未配置")
+				}
+				return core.NewXorReader(r, key.XorKey), nil
+			},
+		},
+		string(core.AES): {
+			encodeWriter: func(w io.Writer, key *CipherKey) (io.WriteCloser, error) {
+				aw, err := core.NewAESEncryptWriter(w, key.AESKey)
+				if err != nil {
+					return nil, err
+				}
+				return nopWriteCloser{aw}, nil
+			},
+			decodeReader: func(r io.Reader, key *CipherKey) (io.Reader, error) {
+				return core.NewAESDecryptReader(r, key.AESKey)
+			},
+		},
+		string(core.Gzip):    compressStream(core.NewGzipWriter, core.NewGzipReader),
+		string(core.Deflate): compressStream(core.NewDeflateWriter, core.NewDeflateReader),
+		string(core.Zlib):    compressStream(core.NewZlibWriter, core.NewZlibReader),
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	for name, stream := range streamable {
+		if base, ok := codecs[name].(*funcCodec); ok {
+			stream.funcCodec = base
+			codecs[name] = stream
+		}
+	}
+}
+
+func compressStream(writer func(io.Writer) io.WriteCloser, reader func(io.Reader) (io.Reader, error)) *streamFuncCodec {
+	return &streamFuncCodec{
+		encodeWriter: func(w io.Writer, _ *CipherKey) (io.WriteCloser, error) {
+			return writer(w), nil
+		},
+		decodeReader: func(r io.Reader, _ *CipherKey) (io.Reader, error) {
+			return reader(r)
+		},
+	}
+}
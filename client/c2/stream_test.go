@@ -0,0 +1,128 @@
+package c2
+
+import (
+	"bytes"
+	"caffeine/core"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func streamTestKey(t *testing.T) CipherKey {
+	key := CipherKey{AES: "lY4XTVY+PNCMoFwxjHsWQi0jW0oNqfScVIUk/KE6a3M=", Xor: "UXwoRqMyaRkUxjvKifu2rw=="}
+	if err := key.parse(); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestStreamChainMatchesBlockCodecs(t *testing.T) {
+	key := streamTestKey(t)
+	data := make([]byte, 300*1024+7)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, chain := range []string{"xor->gzip->base64", "hex->zlib->xor->base64", "aes->deflate->hex", "aes-gcm->base64"} {
+		codecs, err := ParseCodecChain(chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var encoded bytes.Buffer
+		writer, err := NewEncodeWriter(codecs, &encoded, &key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 小块写入，确保各级编码器正确处理边界
+		for chunk := data; len(chunk) > 0; {
+			n := 1000
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+			writer.Write(chunk[:n])
+			chunk = chunk[n:]
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%s: %v", chain, err)
+		}
+
+		// 流式编码的结果可以被块编解码器解开
+		decoded := encoded.Bytes()
+		for i := len(codecs) - 1; i >= 0; i-- {
+			if decoded, err = codecs[i].Decode(decoded, &key); err != nil {
+				t.Fatalf("%s: block decode: %v", chain, err)
+			}
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("%s: block decode mismatch", chain)
+		}
+
+		reader, err := NewDecodeReader(codecs, bytes.NewReader(encoded.Bytes()), &key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(streamed, data) {
+			t.Fatalf("%s: stream decode mismatch: %v", chain, err)
+		}
+	}
+}
+
+func TestStreamHandlers(t *testing.T) {
+	key := streamTestKey(t)
+	for _, location := range []string{PayloadBody, PayloadForm, PayloadMultipart} {
+		conf := C2Yaml{
+			Request: C2Request{
+				Method: "POST", EncodeChain: "gzip->base64",
+				Headers:      []string{"Content-Type:application/json"},
+				FrontPadding: "{\"d\":\"", BackPadding: "\"}",
+				Payload: Payload{Location: location, Name: "pass"},
+			},
+			Response: C2Response{EncodeChain: "xor->base64", FrontPadding: "<p>", BackPadding: "</p>"},
+			Key:      key,
+		}
+		session := &core.Session{Target: core.Target{ShellURL: "http://127.0.0.1/shell.php"}}
+		operation := strings.Repeat("echo 'stream';", 10000)
+
+		req, err := NewRequestHandler(conf).StreamHandler(session, strings.NewReader(operation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Body, err = io.ReadAll(req.BodyReader); err != nil {
+			t.Fatal(err)
+		}
+		if location == PayloadForm && req.Headers["Content-Type"] != "application/x-www-form-urlencoded" {
+			t.Fatalf("unexpected form content type: %s", req.Headers["Content-Type"])
+		}
+		payload, err := conf.Request.Payload.extract(req, "pass")
+		if err != nil {
+			t.Fatalf("%s: %v", location, err)
+		}
+		received, err := emulateServerDecode(conf.Request, payload, &key)
+		if err != nil || string(received) != operation {
+			t.Fatalf("%s: server decode mismatch: %v", location, err)
+		}
+
+		reply := bytes.Repeat([]byte{0, 1, 2, 3}, 50000)
+		response, err := emulateServerEncode(conf.Response, reply, &key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.BodyReader = io.NopCloser(bytes.NewReader(response.Body))
+		stream, err := NewResponseHandler(conf).StreamHandler(session, response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil || !bytes.Equal(got, reply) {
+			t.Fatalf("%s: response decode mismatch: %v", location, err)
+		}
+	}
+}
+
+func TestStreamBackPaddingMismatch(t *testing.T) {
+	reader := newPaddingReader(strings.NewReader("<p>data</x>"), "<p>", "</p>")
+	if _, err := io.ReadAll(reader); err == nil || !strings.Contains(err.Error(), "back padding") {
+		t.Fatalf("expected back padding error, got %v", err)
+	}
+}
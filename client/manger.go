@@ -4,80 +4,207 @@ import (
 	"caffeine/client/c2"
 	"caffeine/client/webshell"
 	"caffeine/core"
+	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type WebShellManger struct {
-	alive      []int64 // 存放在线shell的ID
+	mu         sync.Mutex // 保护 alive、clients、entries 与 ShellEntry 状态，熔断回调在请求协程中调用
+	alive      []int64    // 存放在线shell的ID
 	clients    map[int64]*webshell.WebClient
 	entries    map[int64]*ShellEntry // 存储 ShellEntry 实体
 	db         *gorm.DB              // 添加数据库实例
 	taskManger *webshell.TaskManager
+	profiles   *c2.ProfileLibrary // C2配置库
+	unregister func()             // 注销熔断状态回调
 }
 
 // NewWebShellManager 创建管理器实例
-func NewWebShellManager(db *gorm.DB) *WebShellManger {
-	return &WebShellManger{
+func NewWebShellManager(db *gorm.DB, profiles *c2.ProfileLibrary) *WebShellManger {
+	m := &WebShellManger{
 		alive:      make([]int64, 0),
 		clients:    make(map[int64]*webshell.WebClient),
 		entries:    make(map[int64]*ShellEntry),
 		db:         db,
 		taskManger: webshell.NewTaskManager(),
+		profiles:   profiles,
+	}
+	m.unregister = core.GetHttpEngine().Breaker().OnStateChange(m.onBreakerStateChange)
+	return m
+}
+
+// Close 注销熔断状态回调，管理器不再使用时调用
+func (m *WebShellManger) Close() {
+	m.unregister()
+}
+
+// onBreakerStateChange shell 熔断时标记为离线，恢复后标记为在线
+func (m *WebShellManger) onBreakerStateChange(key string, state core.BreakerState) {
+	id, ok := core.ParseShellKey(key)
+	if !ok {
+		return
+	}
+	switch state {
+	case core.BreakerOpen:
+		m.SetEntryStatus(id, 0)
+	case core.BreakerClosed:
+		m.SetEntryStatus(id, 1)
 	}
 }
 
 // AddEntry 添加 ShellEntry
-func (m *WebShellManger) AddEntry(entry *ShellEntry) {
-	m.entries[entry.ID] = entry
+func (m *WebShellManger) AddEntry(entry *ShellEntry) error {
 	// 同时创建对应的 WebClient
-	client := entry.ToWebClient()
+	client, err := entry.ToWebClient(m.profiles)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entry.ID] = entry
 	m.clients[client.ID] = client
+	return nil
 }
 
 // RemoveEntry 根据ID移除 ShellEntry
 func (m *WebShellManger) RemoveEntry(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.entries, id)
 	delete(m.clients, int64(id))
 	// 同时从在线列表中移除
-	for i, aliveID := range m.alive {
-		if aliveID == id {
-			m.alive = append(m.alive[:i], m.alive[i+1:]...)
-			break
-		}
-	}
+	m.removeAlive(id)
 }
 
 // GetEntry 根据ID获取 ShellEntry
 func (m *WebShellManger) GetEntry(id int64) *ShellEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.entries[id]
 }
 
-// UpdateEntry 更新 ShellEntry
-func (m *WebShellManger) UpdateEntry(entry *ShellEntry) {
-	if _, exists := m.entries[entry.ID]; exists {
+// storeEntry 保存尚未加载的 ShellEntry，不创建 WebClient
+func (m *WebShellManger) storeEntry(entry *ShellEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[entry.ID]; !exists {
 		m.entries[entry.ID] = entry
-		// 同步更新 WebClient
-		client := entry.ToWebClient()
-		m.clients[client.ID] = client
 	}
 }
 
-// SetEntryStatus 设置 ShellEntry 状态
+// GetClient 根据ID获取 WebClient
+func (m *WebShellManger) GetClient(id int64) *webshell.WebClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clients[id]
+}
+
+// UpdateEntry 更新 ShellEntry
+func (m *WebShellManger) UpdateEntry(entry *ShellEntry) error {
+	if m.GetEntry(entry.ID) == nil {
+		return nil
+	}
+	// 同步更新 WebClient，配置可能已更换
+	client, err := entry.ToWebClient(m.profiles)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entry.ID] = entry
+	m.clients[client.ID] = client
+	return nil
+}
+
+// SetEntryStatus 设置 ShellEntry 状态并同步在线列表，状态变化时写入数据库
 func (m *WebShellManger) SetEntryStatus(id int64, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if entry, exists := m.entries[id]; exists {
+		changed := entry.Status != status
 		entry.Status = status
 		if status == 1 { // 在线
-			m.SetAlive(int64(id))
+			m.setAlive(id)
+		} else {
+			m.removeAlive(id)
+		}
+		if changed && m.db != nil {
+			if err := m.db.Model(&ShellEntry{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+				core.GetLogger().Warnf("更新shell %d 状态失败: %v", id, err)
+			}
 		}
 	}
 }
 
 // SetAlive adds the shell ID to the alive list
 func (m *WebShellManger) SetAlive(id int64) {
-	m.alive = append(m.alive, id)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setAlive(id)
+}
+
+func (m *WebShellManger) setAlive(id int64) {
+	if !slices.Contains(m.alive, id) {
+		m.alive = append(m.alive, id)
+	}
+}
+
+// AliveShells 返回在线shell的ID
+func (m *WebShellManger) AliveShells() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.alive)
+}
+
+func (m *WebShellManger) removeAlive(id int64) {
+	if i := slices.Index(m.alive, id); i >= 0 {
+		m.alive = append(m.alive[:i], m.alive[i+1:]...)
+	}
+}
+
+// CheckAll 检测全部shell是否在线并更新状态，返回 shell ID 到检测结果的映射
+// 检测请求均匀分散到基础配置 rate_limit.spread 指定的时间窗口内，避免同时访问大量目标
+// ctx 取消后尚未检测的shell不出现在结果中，状态保持不变
+func (m *WebShellManger) CheckAll(ctx context.Context) map[int64]bool {
+	m.mu.Lock()
+	ids := make([]int64, 0, len(m.clients))
+	for id := range m.clients {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	clients := make([]*webshell.WebClient, len(ids))
+	for i, id := range ids {
+		clients[i] = m.clients[id]
+	}
+	m.mu.Unlock()
+
+	online := make([]bool, len(ids))
+	checked := make([]bool, len(ids))
+	window := time.Duration(core.GetInstance().RateLimit.Spread) * time.Second
+	core.Spread(ctx, len(ids), window, func(i int) {
+		online[i] = clients[i].CheckConnectContext(ctx)
+		checked[i] = ctx.Err() == nil
+	})
+
+	results := make(map[int64]bool, len(ids))
+	for i, id := range ids {
+		if !checked[i] {
+			continue
+		}
+		results[id] = online[i]
+		if online[i] {
+			m.SetEntryStatus(id, 1)
+		} else {
+			m.SetEntryStatus(id, 0)
+		}
+	}
+	return results
 }
 
 func (*WebShellManger) name() {
@@ -85,6 +212,8 @@ func (*WebShellManger) name() {
 }
 
 func (m *WebShellManger) AddWebShell(client *webshell.WebClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.clients[client.ID] = client
 }
 
@@ -98,19 +227,42 @@ type ShellEntry struct {
 	UpdateTime string
 	URL        string
 	Note       string
-	Password   string // shell 密码
-	Encoding   string // 编码方式(如 base64)
-	Status     int    // 状态: 0-离线 1-在线
+	Password   string           // shell 密码
+	Encoding   string           // 编码方式(如 base64)
+	Status     int              // 状态: 0-离线 1-在线
+	Profile    string           // 绑定的C2配置名称，为空时使用默认配置
+	TLS        core.TLSSettings `gorm:"serializer:json"` // shell 单独的TLS配置
+	NoCache    bool             // 不记录该shell的流量
+}
+
+// ProfileName 返回绑定的C2配置名称
+func (e *ShellEntry) ProfileName() string {
+	if e.Profile != "" {
+		return e.Profile
+	}
+	return core.GetInstance().DefaultProfile
 }
 
 // ToWebClient converts ShellEntry to WebClient
-func (e *ShellEntry) ToWebClient() *webshell.WebClient {
+// 使用配置库中绑定的C2配置，客户端ID与 ShellEntry 保持一致
+func (e *ShellEntry) ToWebClient(profiles *c2.ProfileLibrary) (*webshell.WebClient, error) {
+	if profiles == nil {
+		return nil, fmt.Errorf("C2配置库未加载")
+	}
+	config, err := profiles.Get(e.ProfileName())
+	if err != nil {
+		return nil, err
+	}
 	target := core.Target{
+		ID:       e.ID,
 		ShellURL: e.URL,
+		Password: e.Password,
+		TLS:      e.TLS,
+		NoCache:  e.NoCache,
 	}
-	// 使用默认的 C2 配置创建新的 WebClient
-	config := c2.C2Yaml{} // 如果需要特定配置，可以从配置文件或其他地方加载
-	return webshell.NewWebClient(target, config)
+	client := webshell.NewWebClient(target, config)
+	client.ID = e.ID
+	return client, nil
 }
 
 // AddNewShell 添加新的WebShell并保存到数据库
@@ -124,6 +276,9 @@ func (m *WebShellManger) AddNewShell(data map[string]interface{}) (int64, error)
 		Note:       data["note"].(string),
 		Password:   data["password"].(string),
 		Encoding:   data["encoding"].(string),
+		Profile:    stringValue(data, "profile"),
+		TLS:        tlsValue(data, "tls"),
+		NoCache:    boolValue(data, "noCache"),
 		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
 		UpdateTime: time.Now().Format("2006-01-02 15:04:05"),
 		Status:     0, // 默认离线状态
@@ -136,11 +291,35 @@ func (m *WebShellManger) AddNewShell(data map[string]interface{}) (int64, error)
 	}
 
 	// 添加到内存管理
-	m.AddEntry(entry)
+	if err := m.AddEntry(entry); err != nil {
+		return entry.ID, err
+	}
 
 	return entry.ID, nil
 }
 
+// stringValue 读取可选的字符串字段
+func stringValue(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
+
+// boolValue 读取可选的布尔字段
+func boolValue(data map[string]interface{}, key string) bool {
+	value, _ := data[key].(bool)
+	return value
+}
+
+// tlsValue 读取可选的TLS配置，字段名与配置文件相同
+func tlsValue(data map[string]interface{}, key string) core.TLSSettings {
+	var settings core.TLSSettings
+	if value, ok := data[key]; ok {
+		raw, _ := json.Marshal(value)
+		json.Unmarshal(raw, &settings)
+	}
+	return settings
+}
+
 // GetShellList 从数据库获取shell列表
 func (m *WebShellManger) GetShellList() ([]ShellEntry, error) {
 	var entries []ShellEntry
@@ -152,6 +331,8 @@ func (m *WebShellManger) GetShellList() ([]ShellEntry, error) {
 	}
 
 	// 更新内存中的entries
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, entry := range entries {
 		m.entries[entry.ID] = &entry
 	}
@@ -2,6 +2,7 @@ package webshell
 
 import (
 	"caffeine/core"
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -17,6 +18,8 @@ type Terminal struct {
 	IsWindows    bool              // 目标系统是否为Windows
 	LastExitCode int               // 上一条命令的退出码
 	client       *WebClient        // WebShell客户端引用
+	ctx          context.Context   // 终端上下文，关闭终端时取消
+	cancel       context.CancelFunc
 
 	// 新增字段
 	CommandHistory []string  // 命令历史记录
@@ -38,6 +41,7 @@ type TerminalInfo struct {
 func NewTerminal(client *WebClient, path string) *Terminal {
 	sysInfo := client.GetSession().Info
 	isWindows := strings.Contains(strings.ToLower(sysInfo.Os.Name), "windows")
+	ctx, cancel := context.WithCancel(context.Background())
 
 	t := &Terminal{
 		ID:             core.GenerateID(),
@@ -46,6 +50,8 @@ func NewTerminal(client *WebClient, path string) *Terminal {
 		IsWindows:      isWindows,
 		LastExitCode:   0,
 		client:         client,
+		ctx:            ctx,
+		cancel:         cancel,
 		CommandHistory: make([]string, 0),
 		HistoryIndex:   -1,
 		CurrentUser:    sysInfo.CurrentUser,
@@ -82,7 +88,7 @@ func (t *Terminal) Execute(cmd string) string {
 
 	// 格式化并执行命令
 	formattedCmd := t.formatCommand(cmd)
-	output := t.client.RunCMD(t.CurrentPath, formattedCmd)
+	output := t.client.RunCMDContext(t.ctx, t.CurrentPath, formattedCmd)
 
 	// 尝试更新退出码
 	if t.IsWindows {
@@ -94,6 +100,11 @@ func (t *Terminal) Execute(cmd string) string {
 	return output
 }
 
+// Close 关闭终端，中止正在执行的命令
+func (t *Terminal) Close() {
+	t.cancel()
+}
+
 // GetPreviousCommand 获取历史记录中的上一条命令
 func (t *Terminal) GetPreviousCommand() string {
 	if len(t.CommandHistory) == 0 || t.HistoryIndex <= 0 {
@@ -115,7 +126,7 @@ func (t *Terminal) GetNextCommand() string {
 
 // getWindowsExitCode 获取Windows下的命令退出码
 func (t *Terminal) getWindowsExitCode() int {
-	output := t.client.RunCMD(t.CurrentPath, "echo %errorlevel%")
+	output := t.client.RunCMDContext(t.ctx, t.CurrentPath, "echo %errorlevel%")
 	code := 0
 	fmt.Sscanf(output, "%d", &code)
 	return code
@@ -123,7 +134,7 @@ func (t *Terminal) getWindowsExitCode() int {
 
 // getUnixExitCode 获取Unix系统下的命令退出码
 func (t *Terminal) getUnixExitCode() int {
-	output := t.client.RunCMD(t.CurrentPath, "echo $?")
+	output := t.client.RunCMDContext(t.ctx, t.CurrentPath, "echo $?")
 	code := 0
 	fmt.Sscanf(output, "%d", &code)
 	return code
@@ -144,7 +155,7 @@ func (t *Terminal) GetWelcomeMessage() string {
 func (t *Terminal) detectShell() {
 	if t.IsWindows {
 		// 优先检查PowerShell
-		if output := t.client.RunCMD(t.CurrentPath, "where powershell.exe"); strings.Contains(output, "powershell.exe") {
+		if output := t.client.RunCMDContext(t.ctx, t.CurrentPath, "where powershell.exe"); strings.Contains(output, "powershell.exe") {
 			t.ExecutePath = "powershell.exe"
 			return
 		}
@@ -154,11 +165,11 @@ func (t *Terminal) detectShell() {
 	}
 
 	// 类Unix系统: 优先使用bash,其次是sh
-	if output := t.client.RunCMD(t.CurrentPath, "which bash"); output != "" {
+	if output := t.client.RunCMDContext(t.ctx, t.CurrentPath, "which bash"); output != "" {
 		t.ExecutePath = strings.TrimSpace(output)
 		return
 	}
-	if output := t.client.RunCMD(t.CurrentPath, "which sh"); output != "" {
+	if output := t.client.RunCMDContext(t.ctx, t.CurrentPath, "which sh"); output != "" {
 		t.ExecutePath = strings.TrimSpace(output)
 		return
 	}
@@ -189,7 +200,7 @@ func (t *Terminal) handleBuiltInCommands(cmd string) (string, bool) {
 			checkCmd = fmt.Sprintf("[ -d \"%s\" ] && echo Directory_Exists", newPath)
 		}
 
-		if output := t.client.RunCMD(t.CurrentPath, checkCmd); strings.Contains(output, "Directory_Exists") {
+		if output := t.client.RunCMDContext(t.ctx, t.CurrentPath, checkCmd); strings.Contains(output, "Directory_Exists") {
 			t.CurrentPath = newPath
 			return "", true
 		}
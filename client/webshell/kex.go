@@ -0,0 +1,64 @@
+package webshell
+
+import (
+	"caffeine/core"
+	"caffeine/server"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// negotiateSessionKey 与webshell协商会话密钥
+// 双方交换 X25519 临时公钥，静态密钥仅用于 HMAC 认证，泄露配置文件不会暴露已记录的流量
+func (client *WebClient) negotiateSessionKey(ctx context.Context) error {
+	negotiator, ok := client.server.(server.KeyNegotiator)
+	if !ok {
+		return fmt.Errorf("webshell 不支持会话密钥协商")
+	}
+	authKey := client.config.Key.AuthKey()
+	if len(authKey) == 0 {
+		return fmt.Errorf("密钥协商需要配置 aes 密钥用于认证")
+	}
+
+	kex, err := core.NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	clientPublic := kex.PublicKey()
+	mac := core.KexMAC(authKey, core.KexClientLabel, clientPublic)
+	response := client.request(ctx, HookNegotiateKey, negotiator.NegotiateKey(clientPublic, mac))
+	if response == nil {
+		return fmt.Errorf("密钥协商无响应")
+	}
+	if strings.HasPrefix(string(response), "Error://") {
+		return fmt.Errorf("密钥协商失败: %s", response)
+	}
+
+	// 会话标识由服务端生成，避免使用客户端指定的会话
+	split := strings.SplitN(string(response), ":", 3)
+	if len(split) != 3 || split[2] == "" {
+		return fmt.Errorf("无效的密钥协商响应")
+	}
+	serverPublic, err := base64.StdEncoding.DecodeString(split[0])
+	if err != nil {
+		return fmt.Errorf("无效的服务端公钥: %v", err)
+	}
+	serverMac, err := base64.StdEncoding.DecodeString(split[1])
+	if err != nil {
+		return fmt.Errorf("无效的服务端MAC: %v", err)
+	}
+	if !hmac.Equal(serverMac, core.KexMAC(authKey, core.KexServerLabel, clientPublic, serverPublic, []byte(split[2]))) {
+		return fmt.Errorf("服务端公钥认证失败")
+	}
+
+	salt := append(append([]byte{}, clientPublic...), serverPublic...)
+	sessionKey, err := kex.DeriveKey(serverPublic, salt)
+	if err != nil {
+		return err
+	}
+	client.session.SessionKey = sessionKey
+	client.session.SessionToken = split[2]
+	return nil
+}
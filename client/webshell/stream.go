@@ -0,0 +1,106 @@
+package webshell
+
+import (
+	"bufio"
+	"bytes"
+	"caffeine/server"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 流式传输：请求体与响应体都不完整读入内存，用于大文件上传下载
+// 流式请求不经过数据钩子(hooks)，钩子只能处理完整的数据
+
+// uploadDataPlaceholder 上传代码中文件数据的位置，流式上传时在此处拼接base64数据
+const uploadDataPlaceholder = "{{caffeine-upload-data}}"
+
+// 非数据类响应(如上传结果)读取的上限
+const maxStreamReply = 1 << 20
+
+// requestStream 流式发送请求，返回解码后的响应流，调用方负责关闭
+func (client *WebClient) requestStream(ctx context.Context, methodName HookMethod, data io.Reader) (io.ReadCloser, error) {
+	req, err := client.requestHandler.StreamHandlerContext(ctx, client.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s handle request error: %w", methodName, err)
+	}
+	// 请求失败时请求体可能未被读完，关闭以结束生成请求体的协程
+	if closer, ok := req.BodyReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	req.Stream = true
+	req.Operation = string(methodName)
+	if err := client.http.ExecuteRequest(req); err != nil {
+		return nil, fmt.Errorf("%s execute request error: %w", methodName, err)
+	}
+	response, err := client.responseHandler.StreamHandler(client.session, req.Response)
+	if err != nil {
+		return nil, fmt.Errorf("%s handle response error: %w", methodName, err)
+	}
+	return response, nil
+}
+
+// uploadStream 将 data 以base64编码拼接进上传代码中并流式发送，返回服务端输出
+func (client *WebClient) uploadStream(ctx context.Context, methodName HookMethod, code []byte, data io.Reader) (string, error) {
+	parts := bytes.SplitN(code, []byte(uploadDataPlaceholder), 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("%s: 上传代码中缺少数据占位符", methodName)
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		encoder := base64.NewEncoder(base64.StdEncoding, pw)
+		_, err := io.Copy(encoder, data)
+		if err == nil {
+			err = encoder.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	response, err := client.requestStream(ctx, methodName, io.MultiReader(bytes.NewReader(parts[0]), pr, bytes.NewReader(parts[1])))
+	if err != nil {
+		return "", err
+	}
+	defer response.Close()
+	reply, err := io.ReadAll(io.LimitReader(response, maxStreamReply))
+	if err != nil {
+		return "", fmt.Errorf("%s read response error: %w", methodName, err)
+	}
+	return string(reply), nil
+}
+
+// downloadStream 流式下载文件，先写入临时文件，完成后再重命名
+func (client *WebClient) downloadStream(ctx context.Context, downloader server.StreamDownloader, remotePath, localPath string) error {
+	response, err := client.requestStream(ctx, HookDownload, bytes.NewReader(downloader.DownloadStream(remotePath)))
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	reader := bufio.NewReader(response)
+	if prefix, _ := reader.Peek(len("Error://")); string(prefix) == "Error://" {
+		message, _ := io.ReadAll(io.LimitReader(reader, 4096))
+		return fmt.Errorf("%s", strings.TrimPrefix(string(message), "Error://"))
+	}
+
+	partPath := localPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	_, err = io.Copy(file, base64.NewDecoder(base64.StdEncoding, reader))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("download failed: %v", err)
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package webshell
 
 import (
 	"caffeine/core"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -36,6 +37,8 @@ type Task struct {
 	EndTime    time.Time
 	TotalTime  time.Duration
 	err        error
+	ctx        context.Context // 任务上下文，取消任务时中止进行中的请求
+	cancel     context.CancelFunc
 }
 
 func (t *Task) GetID() string {
@@ -63,6 +66,16 @@ func (t *Task) UpdateStatus(status int) {
 	t.Status = status
 }
 
+// Context 返回任务的上下文，DoTask 中的请求应使用该上下文
+func (t *Task) Context() context.Context {
+	return t.ctx
+}
+
+// Cancel 取消任务，正在进行的请求立即中止
+func (t *Task) Cancel() {
+	t.cancel()
+}
+
 type RunableTask interface {
 	GetID() string
 	GetType() string
@@ -70,17 +83,22 @@ type RunableTask interface {
 	SetStartTime(start time.Time)
 	SetEndTime(end time.Time)
 	UpdateStatus(status int)
+	Context() context.Context
+	Cancel()
 	DoTask() error
 	CallBack()
 }
 
 func NewTaskBase(Type string) Task {
+	ctx, cancel := context.WithCancel(context.Background())
 	return Task{
 		ID:         uuid.New().String(),
 		Type:       Type,
 		Progress:   0,
 		CreateTime: time.Now(),
 		Status:     TaskCreating,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
@@ -108,7 +126,7 @@ func (task *FileDownloadTask) DoTask() error {
 	switch task.DownloadType {
 	case SiguredSmall:
 		//小文件以文件读取的方式下载
-		err := task.Client.DownloadFile(task.TargetPath, task.SavePath)
+		err := task.Client.DownloadFileContext(task.Context(), task.TargetPath, task.SavePath)
 		if err != nil {
 			return err
 		}
@@ -154,6 +172,18 @@ func (tm *TaskManager) AddTask(task RunableTask) {
 	tm.submitChan <- task
 }
 
+// CancelTask 取消任务，中止正在进行的请求
+func (tm *TaskManager) CancelTask(id string) error {
+	tm.mu.Lock()
+	task, ok := tm.tasks[id]
+	tm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("task not found: %s", id)
+	}
+	task.Cancel()
+	return nil
+}
+
 // 执行所有任务
 func (tm *TaskManager) ExecuteAll() {
 	var wg sync.WaitGroup
@@ -161,12 +191,19 @@ func (tm *TaskManager) ExecuteAll() {
 		wg.Add(1)
 		go func(task RunableTask) {
 			defer wg.Done()
+			defer task.Cancel() // 释放任务上下文
 			taskID := task.GetID()
 			// 更新任务状态为执行中
 			task.UpdateStatus(TaskRunning)
 			tm.logger.Infof("启动 %s任务 %s", task.GetType(), task.GetID())
 			task.SetStartTime(time.Now())
 			err := task.DoTask()
+			task.SetEndTime(time.Now())
+			if task.Context().Err() != nil {
+				task.UpdateStatus(TaskCancelled)
+				tm.logger.Infof("%s任务 %s 已取消", task.GetType(), taskID)
+				return
+			}
 			if err != nil {
 				task.UpdateStatus(TaskFatalError)
 				tm.logger.Errorf("Error executing task %s: %v", taskID, task)
@@ -0,0 +1,108 @@
+package webshell
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// newBlockingClient 创建连接到测试服务端的客户端，服务端收到请求后一直挂起，
+// 直到客户端中止请求或测试结束。每收到一个请求向 started 发送一次
+func newBlockingClient(t *testing.T) (*WebClient, <-chan struct{}) {
+	started, done := make(chan struct{}, 8), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	data, err := os.ReadFile("../../profiles/c2.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf c2.C2Yaml
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	// 测试服务端在本机，不经过配置中的代理
+	conf.Basic.Proxy = nil
+	core.GetInstance().Proxy.Enabled = false
+	return NewWebClient(core.Target{ShellURL: server.URL}, conf), started
+}
+
+// statusTask 记录任务的状态变化与执行结果
+type statusTask struct {
+	*FileDownloadTask
+	statuses chan int
+	result   chan error
+}
+
+func (t *statusTask) UpdateStatus(status int) {
+	t.FileDownloadTask.UpdateStatus(status)
+	t.statuses <- status
+}
+
+func (t *statusTask) DoTask() error {
+	err := t.FileDownloadTask.DoTask()
+	t.result <- err
+	return err
+}
+
+func TestCancelTaskAbortsRequest(t *testing.T) {
+	client, started := newBlockingClient(t)
+	task := &statusTask{
+		FileDownloadTask: &FileDownloadTask{
+			Task:         NewTaskBase(TaskDownload),
+			Client:       client,
+			DownloadType: SiguredSmall,
+			TargetPath:   "/etc/passwd",
+			SavePath:     filepath.Join(t.TempDir(), "passwd"),
+		},
+		statuses: make(chan int, 4),
+		result:   make(chan error, 1),
+	}
+	manager := NewTaskManager()
+	go manager.ExecuteAll()
+	manager.AddTask(task)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not sent")
+	}
+	if err := manager.CancelTask(task.GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-task.result:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not aborted after cancel")
+	}
+	var status int
+	for status != TaskCancelled {
+		select {
+		case status = <-task.statuses:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("task status is %d, want %d", status, TaskCancelled)
+		}
+	}
+}
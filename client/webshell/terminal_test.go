@@ -0,0 +1,47 @@
+package webshell
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTerminalCloseAbortsCommand(t *testing.T) {
+	client, started := newBlockingClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	// 直接构造终端，避免 NewTerminal 探测 shell 时发出请求
+	terminal := &Terminal{
+		CurrentPath: "/tmp",
+		ExecutePath: "/bin/sh",
+		client:      client,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	output := make(chan string, 1)
+	go func() { output <- terminal.Execute("sleep 60") }()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not sent")
+	}
+	terminal.Close()
+
+	select {
+	case out := <-output:
+		if out != "" {
+			t.Fatalf("unexpected output %q", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not aborted after close")
+	}
+	// 关闭后的命令不再发出请求
+	if out := terminal.Execute("id"); out != "" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	select {
+	case <-started:
+		t.Fatal("request sent after close")
+	default:
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runHar 导出或导入流量缓存中的HAR
+func runHar(args []string) int {
+	flags := flag.NewFlagSet("har", flag.ExitOnError)
+	db := flags.String("db", core.DefaultCacheDB, "流量缓存数据库")
+	output := flags.String("o", "", "export 写入文件，默认输出到标准输出")
+	session := flags.Int64("session", 0, "只导出该会话的流量")
+	shell := flags.Int64("shell", 0, "只导出该shell的流量")
+	operation := flags.String("op", "", "只导出该操作(如 RunCmd)的流量")
+	since := flags.String("since", "", "开始时间(RFC3339)")
+	until := flags.String("until", "", "结束时间(RFC3339)")
+	plaintext := flags.Bool("plaintext", false, "在注释中附加解码后的明文")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: c2ctl har [-db file] export [-session id] [-shell id] [-op name] [-since time] [-until time] [-plaintext] [-o file]
+       c2ctl har [-db file] import <file.har>...`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	// 子命令之后的参数
+	action := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+
+	cache, err := core.NewCacheManager(*db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cache.CloseAndCleanup()
+
+	switch action {
+	case "export":
+		opts := core.HarOptions{Plaintext: *plaintext}
+		opts.SessionID, opts.ShellID, opts.Operation = *session, *shell, *operation
+		if opts.Since, err = parseTime(*since); err == nil {
+			opts.Until, err = parseTime(*until)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		out := os.Stdout
+		if *output != "" {
+			if out, err = os.Create(*output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer out.Close()
+		}
+		count, err := cache.WriteHAR(out, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "已导出 %d 条流量\n", count)
+	case "import":
+		if flags.NArg() == 0 {
+			flags.Usage()
+			return 2
+		}
+		status := 0
+		for _, path := range flags.Args() {
+			count, err := importHar(cache, path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				status = 1
+				continue
+			}
+			fmt.Printf("%s: 已导入 %d 条流量\n", path, count)
+		}
+		return status
+	default:
+		flags.Usage()
+		return 2
+	}
+	return 0
+}
+
+func importHar(cache *core.CacheManager, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return cache.ImportHAR(file)
+}
+
+// parseTime 解析 RFC3339 时间，为空时返回零值
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
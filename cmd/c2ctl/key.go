@@ -0,0 +1,91 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runKey 密钥库管理: gen/list/show/rm
+func runKey(args []string) int {
+	flags := flag.NewFlagSet("key", flag.ExitOnError)
+	dir := flags.String("dir", core.GetInstance().KeyStoreDir, "密钥库目录")
+	keyType := flags.String("type", c2.StoredAES, "密钥类型: "+strings.Join(c2.StoredKeyTypes, "/"))
+	size := flags.Int("size", 0, "aes/xor 为字节数，rsa 为位数，0 使用默认值")
+	public := flags.Bool("public", false, "show 时输出RSA公钥")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: c2ctl key [-dir dir] gen [-type aes|xor|rsa] [-size n] <id>
+       c2ctl key [-dir dir] list
+       c2ctl key [-dir dir] show [-public] <id>
+       c2ctl key [-dir dir] rm <id>`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	// 子命令之后的参数
+	action := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	store := c2.NewKeyStore(*dir)
+
+	switch action {
+	case "gen":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		key, err := store.Generate(flags.Arg(0), *keyType, *size)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s: 已生成 %s 密钥，配置中使用 key.%s_id: %s\n", key.ID, key.Type, key.Type, key.ID)
+	case "list":
+		keys, err := store.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, key := range keys {
+			fmt.Printf("%-20s %-4s %s\n", key.ID, key.Type, key.Created.Format("2006-01-02 15:04:05"))
+		}
+	case "show":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		key, err := store.Get(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if *public {
+			publicKey, err := key.PublicKey()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Println(publicKey)
+		} else {
+			fmt.Println(key.Material)
+		}
+	case "rm":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		if err := store.Delete(flags.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	return 0
+}
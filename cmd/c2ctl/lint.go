@@ -0,0 +1,43 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runLint 检查配置文件，存在错误时返回1
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "警告也视为失败")
+	keyDir := flags.String("keys", core.GetInstance().KeyStoreDir, "密钥库目录")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: c2ctl lint [-strict] [-keys dir] <profile.yaml>...")
+		return 2
+	}
+
+	store := c2.NewKeyStore(*keyDir)
+	failed := false
+	for _, file := range flags.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		diags := c2.LintBytesWithStore(data, store)
+		for _, d := range diags {
+			fmt.Printf("%s: %s\n", file, d)
+		}
+		if c2.HasErrors(diags) || (*strict && len(diags) > 0) {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+// c2ctl C2配置管理工具
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// 子命令
+var commands = map[string]func(args []string) int{
+	"lint":     runLint,
+	"selftest": runSelfTest,
+	"profiles": runProfiles,
+	"key":      runKey,
+	"migrate":  runMigrate,
+	"schema":   runSchema,
+	"har":      runHar,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: c2ctl <command> [arguments]
+
+commands:
+  lint <profile.yaml>...          检查C2配置并输出全部问题
+  selftest <profile.yaml>...      模拟服务端进行请求/响应往返自检
+  profiles [-dir dir]             列出配置目录中的全部配置及使用的密钥
+  key gen|list|show|rm            管理本地密钥库
+  migrate [-w] <profile.yaml>...  升级配置到当前版本
+  schema [-o file] [profile|settings]
+                                  输出C2配置或基础配置的JSON Schema
+  har export|import               导出或导入流量缓存中的HAR
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(command(os.Args[2:]))
+}
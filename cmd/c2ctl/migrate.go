@@ -0,0 +1,59 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMigrate 将配置升级到当前版本，默认只输出迁移内容，-w 时写回文件
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	write := flags.Bool("w", false, "将迁移结果写回文件")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: c2ctl migrate [-w] <profile.yaml>...")
+		return 2
+	}
+
+	failed := false
+	for _, file := range flags.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		out, migrated, err := c2.MigrateBytes(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		if out == nil {
+			fmt.Printf("%s: 已是版本 %d\n", file, c2.CurrentVersion)
+			continue
+		}
+		for _, note := range migrated {
+			fmt.Printf("%s: %s\n", file, note)
+		}
+		if !*write {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		if err := os.WriteFile(file, out, info.Mode().Perm()); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
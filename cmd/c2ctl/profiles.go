@@ -0,0 +1,51 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runProfiles 列出配置目录中的全部配置及加载错误
+func runProfiles(args []string) int {
+	flags := flag.NewFlagSet("profiles", flag.ExitOnError)
+	dir := flags.String("dir", core.GetInstance().ProfileDir, "C2配置目录")
+	keyDir := flags.String("keys", core.GetInstance().KeyStoreDir, "密钥库目录")
+	flags.Parse(args)
+
+	library, err := c2.NewProfileLibrary(*dir, c2.NewKeyStore(*keyDir))
+	for _, info := range library.List() {
+		keys := make([]string, len(info.Keys))
+		for i, ref := range info.Keys {
+			keys[i] = ref.String()
+		}
+		line := fmt.Sprintf("%-20s %s", info.Name, info.File)
+		if info.Extends != "" {
+			line += " (extends " + info.Extends + ")"
+		}
+		if len(keys) > 0 {
+			line += " keys: " + strings.Join(keys, ", ")
+		}
+		fmt.Println(line)
+	}
+	if err == nil {
+		return 0
+	}
+	errs := library.Errors()
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", key, errs[key])
+	}
+	if len(keys) == 0 {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return 1
+}
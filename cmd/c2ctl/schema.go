@@ -0,0 +1,41 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runSchema 输出C2配置或基础配置的 JSON Schema，供编辑器校验与补全
+func runSchema(args []string) int {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	output := flags.String("o", "", "写入文件，默认输出到标准输出")
+	flags.Parse(args)
+
+	var schema *core.Schema
+	switch flags.Arg(0) {
+	case "", "profile":
+		schema = c2.ProfileSchema()
+	case "settings":
+		schema = core.BasicConfigSchema()
+	default:
+		fmt.Fprintln(os.Stderr, "usage: c2ctl schema [-o file] [profile|settings]")
+		return 2
+	}
+	data, err := schema.JSON()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+		return 0
+	}
+	if err := os.WriteFile(*output, append(data, '\n'), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
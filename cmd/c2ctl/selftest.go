@@ -0,0 +1,60 @@
+package main
+
+import (
+	"caffeine/client/c2"
+	"caffeine/core"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runSelfTest 在本地模拟服务端，对配置进行往返自检
+func runSelfTest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	operation := flags.String("op", "echo 'caffeine';", "用于自检的操作内容")
+	keyDir := flags.String("keys", core.GetInstance().KeyStoreDir, "密钥库目录")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: c2ctl selftest [-op payload] [-keys dir] <profile.yaml>...")
+		return 2
+	}
+
+	store := c2.NewKeyStore(*keyDir)
+	failed := false
+	for _, file := range flags.Args() {
+		profile, err := loadProfile(file, store)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		report := c2.SelfTest(profile, []byte(*operation))
+		for _, stage := range report.Stages {
+			status := "ok"
+			if !stage.OK {
+				status = "FAIL"
+			}
+			fmt.Printf("%s: %-4s %-13s %s\n", file, status, stage.Name, stage.Detail)
+		}
+		if !report.OK() {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// loadProfile 读取并解析配置文件，旧版本配置在内存中迁移，引用的密钥从 store 中取出
+func loadProfile(file string, store *c2.KeyStore) (c2.C2Yaml, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return c2.C2Yaml{}, err
+	}
+	profile, _, err := c2.LoadProfile(data)
+	if err != nil {
+		return profile, err
+	}
+	return profile, profile.Key.Resolve(store)
+}
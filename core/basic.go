@@ -19,6 +19,24 @@ type BasicConfig struct {
 	// 全局超时设置
 	Timeout TimeoutSettings `yaml:"timeout"`
 
+	// 请求限速，按目标主机分别计算
+	RateLimit      RateLimitSettings            `yaml:"rate_limit"`       // 每个主机的默认限制
+	HostRateLimits map[string]RateLimitSettings `yaml:"host_rate_limits"` // 指定主机的限制，键支持 *.example.com
+
+	// 目标熔断，连续失败的目标在冷却时间内直接失败
+	CircuitBreaker CircuitBreakerSettings `yaml:"circuit_breaker"`
+
+	// 流量缓存的保留策略
+	TrafficCache TrafficCacheSettings `yaml:"traffic_cache"`
+
+	// 指标导出
+	Metrics MetricsSettings `yaml:"metrics"`
+
+	// C2配置库
+	ProfileDir     string `yaml:"profile_dir"`     // C2配置目录
+	DefaultProfile string `yaml:"default_profile"` // 未绑定配置的shell使用的配置名称
+	KeyStoreDir    string `yaml:"key_store_dir"`   // 本地密钥库目录
+
 	// 实例锁
 	mu sync.RWMutex
 }
@@ -50,8 +68,17 @@ type ProxySettings struct {
 	Retries int  `yaml:"retries"` // 重试次数
 
 	// 代理池设置
-	ProxyPool []string `yaml:"proxy_pool"` // 代理池
-	PoolMode  string   `yaml:"pool_mode"`  // round-robin/random/weight
+	ProxyPool    []string         `yaml:"proxy_pool"`    // 代理池
+	PoolMode     string           `yaml:"pool_mode"`     // round-robin/random/weight
+	ProxyWeights map[string]int   `yaml:"proxy_weights"` // 代理权重，weight 模式使用，未设置时为1
+	HealthCheck  ProxyHealthCheck `yaml:"health_check"`  // 代理池健康检查
+}
+
+// ProxyHealthCheck 代理池健康检查配置
+type ProxyHealthCheck struct {
+	Interval    int    `yaml:"interval"`     // 检查间隔(秒)，0 表示不检查
+	URL         string `yaml:"url"`          // 经代理访问的探测地址，为空时只检查代理端口是否可连接
+	MaxFailures int    `yaml:"max_failures"` // 连续失败次数达到后暂时移出代理池
 }
 
 // TimeoutSettings 超时配置
@@ -75,6 +102,10 @@ var defaultConfig = BasicConfig{
 		PoolMode: "round-robin",
 
 		ProxyPool: []string{"http://127.0.0.1:8083"},
+		HealthCheck: ProxyHealthCheck{
+			Interval:    60,
+			MaxFailures: 3,
+		},
 	},
 	Timeout: TimeoutSettings{
 		Dial:      10,
@@ -82,6 +113,24 @@ var defaultConfig = BasicConfig{
 		Write:     30,
 		KeepAlive: 60,
 	},
+	RateLimit: RateLimitSettings{
+		Spread: 10,
+	},
+	CircuitBreaker: CircuitBreakerSettings{
+		Threshold: 5,
+		Cooldown:  30,
+	},
+	TrafficCache: TrafficCacheSettings{
+		Enabled:       true,
+		MaxAge:        7 * 24,
+		MaxRows:       100000,
+		MaxSize:       512,
+		MaxBody:       1024,
+		PruneInterval: 10,
+	},
+	ProfileDir:     "profiles",
+	DefaultProfile: "c2",
+	KeyStoreDir:    "keys",
 }
 
 // GetInstance 获取全局唯一实例
@@ -98,6 +147,16 @@ func (c *BasicConfig) Reset() {
 	defer c.mu.Unlock()
 	c.Proxy = defaultConfig.Proxy
 	c.Timeout = defaultConfig.Timeout
+	c.RateLimit = defaultConfig.RateLimit
+	c.HostRateLimits = defaultConfig.HostRateLimits
+	c.CircuitBreaker = defaultConfig.CircuitBreaker
+	c.TrafficCache = defaultConfig.TrafficCache
+	c.Metrics = defaultConfig.Metrics
+	c.ProfileDir = defaultConfig.ProfileDir
+	c.DefaultProfile = defaultConfig.DefaultProfile
+	c.KeyStoreDir = defaultConfig.KeyStoreDir
+	GetProxyPool().Update(c.Proxy)
+	c.updateMetrics()
 }
 
 // Update 更新配置
@@ -106,6 +165,23 @@ func (c *BasicConfig) Update(newConfig BasicConfig) {
 	defer c.mu.Unlock()
 	c.Proxy = newConfig.Proxy
 	c.Timeout = newConfig.Timeout
+	c.RateLimit = newConfig.RateLimit
+	c.HostRateLimits = newConfig.HostRateLimits
+	c.CircuitBreaker = newConfig.CircuitBreaker
+	c.TrafficCache = newConfig.TrafficCache
+	c.Metrics = newConfig.Metrics
+	c.ProfileDir = newConfig.ProfileDir
+	c.DefaultProfile = newConfig.DefaultProfile
+	c.KeyStoreDir = newConfig.KeyStoreDir
+	GetProxyPool().Update(c.Proxy)
+	c.updateMetrics()
+}
+
+// updateMetrics 按配置启动或停止指标导出
+func (c *BasicConfig) updateMetrics() {
+	if err := GetMetricsExporter().Update(c.Metrics.Listen); err != nil {
+		logger.Warnf("启动指标导出失败: %v", err)
+	}
 }
 
 // GetProxyURL 根据协议获取代理地址
@@ -116,7 +192,10 @@ func (p *ProxySettings) GetProxyURL(protocol string) string {
 
 	// 如果配置了代理池，从代理池中选择
 	if len(p.ProxyPool) > 0 {
-		return p.getProxyFromPool()
+		if proxy := GetProxyPool().Next(nil); proxy != nil {
+			return proxy.String()
+		}
+		return ""
 	}
 
 	switch protocol {
@@ -131,24 +210,6 @@ func (p *ProxySettings) GetProxyURL(protocol string) string {
 	}
 }
 
-// getProxyFromPool 从代理池中获取代理地址
-func (p *ProxySettings) getProxyFromPool() string {
-	if len(p.ProxyPool) == 0 {
-		return ""
-	}
-
-	// 根据池模式选择代理
-	switch p.PoolMode {
-	case "random":
-		return p.ProxyPool[time.Now().UnixNano()%int64(len(p.ProxyPool))]
-	case "round-robin":
-		// 这里需要维护一个计数器，简化版本直接用时间
-		return p.ProxyPool[time.Now().Second()%len(p.ProxyPool)]
-	default:
-		return p.ProxyPool[0]
-	}
-}
-
 // ShouldUseProxy 判断是否应该使用代理
 func (p *ProxySettings) ShouldUseProxy(host string) bool {
 	if !p.Enabled {
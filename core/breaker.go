@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 按目标熔断：连续失败达到阈值后打开，打开期间请求直接失败
+// 冷却时间过后进入半开状态，只放行一个探测请求，成功则关闭，失败则重新打开
+
+// ErrCircuitOpen 目标熔断期间请求直接返回的错误
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 直接失败
+	BreakerHalfOpen                     // 放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerSettings 熔断配置
+type CircuitBreakerSettings struct {
+	Threshold int `yaml:"threshold"` // 连续失败次数达到后熔断，0 表示不熔断
+	Cooldown  int `yaml:"cooldown"`  // 熔断后多久(秒)放行探测请求
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool // 半开状态下探测请求是否已放行
+}
+
+// CircuitBreaker 按目标维护熔断状态
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	settings func() CircuitBreakerSettings
+	handlers []*breakerHandler
+}
+
+// NewCircuitBreaker 创建熔断器，settings 在每次判断时调用，配置修改后立即生效
+func NewCircuitBreaker(settings func() CircuitBreakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{breakers: make(map[string]*breaker), settings: settings}
+}
+
+// breakerHandler 状态变化回调，以指针区分便于注销
+type breakerHandler struct {
+	fn func(key string, state BreakerState)
+}
+
+// OnStateChange 注册状态变化回调，回调在状态变化的请求所在的协程中调用
+// 返回注销函数，回调列表写时复制，通知过程中注销不影响本次通知
+func (cb *CircuitBreaker) OnStateChange(handler func(key string, state BreakerState)) func() {
+	h := &breakerHandler{fn: handler}
+	cb.mu.Lock()
+	cb.handlers = append(slices.Clip(cb.handlers), h)
+	cb.mu.Unlock()
+	return func() {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		if i := slices.Index(cb.handlers, h); i >= 0 {
+			cb.handlers = slices.Delete(slices.Clone(cb.handlers), i, i+1)
+		}
+	}
+}
+
+// Allow 判断是否放行目标的请求，熔断期间返回 ErrCircuitOpen
+func (cb *CircuitBreaker) Allow(key string) error {
+	settings := cb.settings()
+	if settings.Threshold <= 0 {
+		return nil
+	}
+	cb.mu.Lock()
+	b, ok := cb.breakers[key]
+	if !ok {
+		cb.mu.Unlock()
+		return nil
+	}
+	var changed bool
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < time.Duration(settings.Cooldown)*time.Second {
+			cb.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.state, b.probing, changed = BreakerHalfOpen, true, true
+	case BreakerHalfOpen:
+		if b.probing {
+			cb.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	handlers := cb.handlers
+	cb.mu.Unlock()
+	if changed {
+		notify(handlers, key, BreakerHalfOpen)
+	}
+	return nil
+}
+
+// Success 记录目标请求成功，关闭熔断器
+func (cb *CircuitBreaker) Success(key string) {
+	cb.mu.Lock()
+	b, ok := cb.breakers[key]
+	if !ok {
+		cb.mu.Unlock()
+		return
+	}
+	changed := b.state != BreakerClosed
+	delete(cb.breakers, key)
+	handlers := cb.handlers
+	cb.mu.Unlock()
+	if changed {
+		notify(handlers, key, BreakerClosed)
+	}
+}
+
+// Failure 记录目标请求失败，连续失败达到阈值或半开探测失败时打开熔断器
+func (cb *CircuitBreaker) Failure(key string) {
+	settings := cb.settings()
+	if settings.Threshold <= 0 {
+		return
+	}
+	cb.mu.Lock()
+	b, ok := cb.breakers[key]
+	if !ok {
+		b = &breaker{}
+		cb.breakers[key] = b
+	}
+	b.failures++
+	changed := false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= settings.Threshold) {
+		b.state, b.openedAt, b.probing, changed = BreakerOpen, time.Now(), false, true
+	}
+	handlers := cb.handlers
+	cb.mu.Unlock()
+	if changed {
+		notify(handlers, key, BreakerOpen)
+	}
+}
+
+// Abort 放行的请求没有得出结果(如被取消)时调用，半开状态下允许重新探测
+func (cb *CircuitBreaker) Abort(key string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if b, ok := cb.breakers[key]; ok && b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// State 返回目标当前的熔断状态
+func (cb *CircuitBreaker) State(key string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if b, ok := cb.breakers[key]; ok {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+// Reset 清除目标的熔断状态且不触发回调，如用户手动测试连接之前
+func (cb *CircuitBreaker) Reset(key string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.breakers, key)
+}
+
+func notify(handlers []*breakerHandler, key string, state BreakerState) {
+	for _, handler := range handlers {
+		handler.fn(key, state)
+	}
+}
+
+// circuitBreaker 返回熔断配置
+func (c *BasicConfig) circuitBreaker() CircuitBreakerSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.CircuitBreaker
+}
+
+// Breaker 返回引擎的熔断器，可注册状态变化回调
+func (engine *HttpEngine) Breaker() *CircuitBreaker {
+	return engine.breaker
+}
+
+// recordOutcome 按请求结果更新目标的熔断状态
+func (engine *HttpEngine) recordOutcome(ctx context.Context, key string, err error) {
+	switch {
+	case err == nil:
+		engine.breaker.Success(key)
+	case ctx.Err() != nil, errors.Is(err, ErrLocalConfig):
+		// 请求被取消或因本地配置错误未发出，不能说明目标是否可用
+		engine.breaker.Abort(key)
+	case isTargetFailure(err):
+		engine.breaker.Failure(key)
+	default:
+		// 目标已响应(如 403)，说明目标可用
+		engine.breaker.Success(key)
+	}
+}
+
+// breakerKey 请求的熔断键，请求未指定目标时按主机计算
+func breakerKey(req *HttpRequest) string {
+	if req.Target != "" {
+		return req.Target
+	}
+	return hostKey(req.URL)
+}
+
+// isTargetFailure 判断错误是否说明目标不可用：连接失败、超时、404 与 5xx
+// 限速(429)、请求被取消与本地配置错误不计入
+func isTargetFailure(err error) bool {
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+	switch {
+	case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrLocalConfig):
+		return false
+	case httpErr.Code == 0:
+		return true
+	case httpErr.Code == http.StatusNotFound, httpErr.Code >= 500:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	settings := CircuitBreakerSettings{Threshold: 2, Cooldown: 0}
+	cb := NewCircuitBreaker(func() CircuitBreakerSettings { return settings })
+	var states []BreakerState
+	unregister := cb.OnStateChange(func(key string, state BreakerState) { states = append(states, state) })
+
+	settings.Cooldown = 60
+	cb.Failure("shell:1")
+	if err := cb.Allow("shell:1"); err != nil {
+		t.Fatalf("opened before threshold: %v", err)
+	}
+	cb.Failure("shell:1")
+	if err := cb.Allow("shell:1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+
+	// 冷却结束后只放行一个探测请求
+	settings.Cooldown = 0
+	time.Sleep(time.Millisecond)
+	if err := cb.Allow("shell:1"); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if err := cb.Allow("shell:1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("second request allowed while half-open")
+	}
+	cb.Success("shell:1")
+	if state := cb.State("shell:1"); state != BreakerClosed {
+		t.Fatalf("unexpected state %v", state)
+	}
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(states) != len(want) {
+		t.Fatalf("unexpected transitions %v", states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("unexpected transitions %v", states)
+		}
+	}
+
+	unregister()
+	cb.Failure("shell:2")
+	cb.Failure("shell:2")
+	if len(states) != len(want) {
+		t.Fatalf("handler called after unregister: %v", states)
+	}
+}
+
+func TestLocalConfigErrorKeepsBreakerClosed(t *testing.T) {
+	engine := NewHttpEngine(&HttpEngineConfig{MaxConns: 2, PoolSize: 1, Timeout: 5 * time.Second})
+	threshold := GetInstance().circuitBreaker().Threshold
+	for i := 0; i <= threshold; i++ {
+		req := NewHttpRequest()
+		req.Method, req.URL, req.Headers, req.Target = "GET", "https://127.0.0.1:1/", map[string]string{}, ShellKey(9)
+		req.TLS, req.NoCache = &TLSSettings{CAFile: "testdata/missing-ca.pem"}, true
+		if err := engine.ExecuteRequest(req); !errors.Is(err, ErrLocalConfig) {
+			t.Fatalf("expected local config error, got %v", err)
+		}
+	}
+	if state := engine.Breaker().State(ShellKey(9)); state != BreakerClosed {
+		t.Fatalf("bad ca_file changed breaker state to %v", state)
+	}
+}
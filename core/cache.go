@@ -13,6 +13,9 @@ import (
 type CacheManager struct {
 	db              *gorm.DB
 	mu              sync.RWMutex
+	plainMu         sync.Mutex                 // 保证响应明文与缓存写入的先后顺序
+	pendingPlain    map[int64]pendingPlaintext // 缓存写入前到达的响应明文
+	stopPrune       chan struct{}              // 停止定期清理
 	sessionCache    map[int64]*Session
 	systemInfoCache map[int64]*SystemInfo
 	fileSystemCache map[string]*FileSystemCache
@@ -44,44 +47,77 @@ type SystemInfoCache struct {
 
 // HttpCache 数据库模型
 type HttpCache struct {
-	ID         int64 `gorm:"primarykey"`
-	RequestID  int64 `gorm:"index"`
+	ID         int64  `gorm:"primarykey"`
+	RequestID  int64  `gorm:"index"`
+	SessionID  int64  `gorm:"index"` // 发出请求的会话
+	ShellID    int64  `gorm:"index"` // 请求所属的shell
+	Operation  string `gorm:"index"` // 发出请求的操作，如 RunCmd
 	Method     string
 	URL        string
 	ReqHeader  json.RawMessage
 	ReqBody    []byte
+	ReqPlain   []byte // 编码前的请求明文
 	RespCode   int
 	RespHeader json.RawMessage
 	RespBody   []byte
-	CreatedAt  time.Time
+	RespPlain  []byte    // 解码后的响应明文
+	ReqSize    int64     // 请求体原始大小
+	RespSize   int64     // 响应体原始大小
+	Truncated  bool      // 报文或明文是否被截断
+	Duration   int64     // 耗时(毫秒)
+	CreatedAt  time.Time `gorm:"index"`
 }
 
+// pendingPlaintext 等待缓存写入的响应明文
+type pendingPlaintext struct {
+	data      []byte
+	truncated bool
+	at        time.Time
+}
+
+// 超过该时间仍未写入缓存的响应明文被丢弃(请求未被缓存)
+const pendingPlaintextTTL = time.Minute
+
 var (
 	cacheManager *CacheManager
 	once         sync.Once
 )
 
+// DefaultCacheDB 全局缓存使用的数据库文件
+const DefaultCacheDB = "cache.db"
+
 func GetCacheManager() *CacheManager {
 	once.Do(func() {
-		db, err := gorm.Open(sqlite.Open("cache.db"), &gorm.Config{})
+		manager, err := NewCacheManager(DefaultCacheDB)
 		if err != nil {
 			panic("failed to connect database")
 		}
-
-		// Auto migrate schemas
-		db.AutoMigrate(&SessionCache{}, &SystemInfoCache{}, &HttpCache{})
-
-		cacheManager = &CacheManager{
-			db:              db,
-			sessionCache:    make(map[int64]*Session),
-			systemInfoCache: make(map[int64]*SystemInfo),
-			fileSystemCache: make(map[string]*FileSystemCache),
-			directories:     make(map[string]*Directory),
-		}
+		cacheManager = manager
+		manager.startPruning()
 	})
 	return cacheManager
 }
 
+// NewCacheManager 打开指定的缓存数据库，如 c2ctl 读取其他位置的缓存
+func NewCacheManager(path string) (*CacheManager, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Auto migrate schemas
+	db.AutoMigrate(&SessionCache{}, &SystemInfoCache{}, &HttpCache{})
+
+	return &CacheManager{
+		db:              db,
+		sessionCache:    make(map[int64]*Session),
+		systemInfoCache: make(map[int64]*SystemInfo),
+		fileSystemCache: make(map[string]*FileSystemCache),
+		directories:     make(map[string]*Directory),
+		pendingPlain:    make(map[int64]pendingPlaintext),
+	}, nil
+}
+
 // Session cache methods
 func (cm *CacheManager) SaveSession(session *Session) error {
 	cm.mu.Lock()
@@ -255,21 +291,72 @@ func (cm *CacheManager) SaveToCache(req *HttpRequest) error {
 	reqHeaders, _ := json.Marshal(req.Headers)
 	respHeaders, _ := json.Marshal(req.Response.Headers)
 
+	createdAt := req.started
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	settings := GetInstance().trafficCache()
+	limit := settings.MaxBody << 10
+	reqBody, reqTruncated := truncate(req.Body, limit)
+	respBody, respTruncated := truncate(req.Response.Body, limit)
+	reqPlain, plainTruncated := truncate(req.Plaintext, limit)
 	cache := HttpCache{
 		RequestID:  req.ID,
+		SessionID:  req.SessionID,
+		ShellID:    req.ShellID,
+		Operation:  req.Operation,
 		Method:     req.Method,
 		URL:        req.URL,
 		ReqHeader:  reqHeaders,
-		ReqBody:    req.Body,
+		ReqBody:    reqBody,
+		ReqPlain:   reqPlain,
+		ReqSize:    int64(len(req.Body)),
 		RespCode:   req.Response.code,
 		RespHeader: respHeaders,
-		RespBody:   req.Response.Body,
-		CreatedAt:  time.Now(),
+		RespBody:   respBody,
+		RespSize:   int64(len(req.Response.Body)),
+		Truncated:  reqTruncated || respTruncated || plainTruncated,
+		Duration:   req.duration.Milliseconds(),
+		CreatedAt:  createdAt,
 	}
 
+	cm.plainMu.Lock()
+	defer cm.plainMu.Unlock()
+	if pending, ok := cm.pendingPlain[req.ID]; ok {
+		cache.RespPlain = pending.data
+		cache.Truncated = cache.Truncated || pending.truncated
+		delete(cm.pendingPlain, req.ID)
+	}
 	return cm.db.Create(&cache).Error
 }
 
+// SetResponsePlaintext 记录请求解码后的响应明文
+// 缓存异步写入，明文先于缓存到达时暂存，写入缓存时一并保存
+func (cm *CacheManager) SetResponsePlaintext(requestID int64, plaintext []byte) error {
+	plaintext, truncated := truncate(plaintext, GetInstance().trafficCache().MaxBody<<10)
+	updates := map[string]interface{}{"resp_plain": plaintext}
+	if truncated {
+		updates["truncated"] = true
+	}
+	cm.plainMu.Lock()
+	defer cm.plainMu.Unlock()
+	result := cm.db.Model(&HttpCache{}).Where("request_id = ?", requestID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	now := time.Now()
+	for id, pending := range cm.pendingPlain {
+		if now.Sub(pending.at) > pendingPlaintextTTL {
+			delete(cm.pendingPlain, id)
+		}
+	}
+	cm.pendingPlain[requestID] = pendingPlaintext{data: plaintext, truncated: truncated, at: now}
+	return nil
+}
+
 // GetFromCache 从缓存获取 HTTP 请求
 func (cm *CacheManager) GetFromCache(requestID int64) (*HttpRequest, error) {
 	var cache HttpCache
@@ -301,6 +388,11 @@ func (cm *CacheManager) CloseAndCleanup() error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	if cm.stopPrune != nil {
+		close(cm.stopPrune)
+		cm.stopPrune = nil
+	}
+
 	// Clear in-memory caches
 	cm.sessionCache = make(map[int64]*Session)
 	cm.systemInfoCache = make(map[int64]*SystemInfo)
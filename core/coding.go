@@ -1,12 +1,17 @@
 package core
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -24,9 +29,17 @@ const (
 	Base64 CryptoAlgorithm = "base64"
 	Hex    CryptoAlgorithm = "hex"
 	Xor    CryptoAlgorithm = "xor"
+	AESGCM CryptoAlgorithm = "aes-gcm"
+	// 压缩算法，对应PHP的 gzencode/gzdeflate/gzcompress
+	Gzip    CryptoAlgorithm = "gzip"
+	Deflate CryptoAlgorithm = "deflate"
+	Zlib    CryptoAlgorithm = "zlib"
 	// 可扩展更多算法和编码方式
 )
 
+// ErrIntegrity 认证加密校验失败，密文被篡改或损坏
+var ErrIntegrity = errors.New("integrity check failed: ciphertext corrupted or tampered")
+
 func Base64Encode(src []byte) []byte {
 	encoded := base64.StdEncoding.EncodeToString(src)
 	return []byte(encoded)
@@ -98,6 +111,110 @@ func AESDecode(cipherText, key []byte) ([]byte, error) {
 	return plainText, nil
 }
 
+// AESGCMEncode 使用 AES-GCM 对明文进行认证加密
+// 返回 nonce(12字节) + 密文 + tag(16字节)，每次加密使用随机 nonce
+func AESGCMEncode(plainText, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plainText)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plainText, nil), nil
+}
+
+// AESGCMDecode 解密 AESGCMEncode 的输出，校验失败时返回 ErrIntegrity
+func AESGCMDecode(cipherText, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: cipherText too short", ErrIntegrity)
+	}
+	nonce, encrypted := cipherText[:gcm.NonceSize()], cipherText[gcm.NonceSize():]
+	plainText, err := gcm.Open(nil, nonce, encrypted, nil)
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	return plainText, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, errors.New("AES key length must be 16, 24, or 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GzipEncode gzip压缩
+func GzipEncode(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	return compress(&b, w, src)
+}
+
+// GzipDecode gzip解压
+func GzipDecode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(r)
+}
+
+// DeflateEncode 原始deflate压缩(无头部)
+func DeflateEncode(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return compress(&b, w, src)
+}
+
+// DeflateDecode 原始deflate解压
+func DeflateDecode(src []byte) ([]byte, error) {
+	return decompress(flate.NewReader(bytes.NewReader(src)))
+}
+
+// ZlibEncode zlib压缩
+func ZlibEncode(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	return compress(&b, w, src)
+}
+
+// ZlibDecode zlib解压
+func ZlibDecode(src []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(r)
+}
+
+func compress(b *bytes.Buffer, w io.WriteCloser, src []byte) ([]byte, error) {
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func decompress(r io.ReadCloser) ([]byte, error) {
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
 // UnHex 将十六进制编码的字节数组解码成实际的字节数组
 func UnHex(src []byte) ([]byte, error) {
 	// 检查 src 是否包含偶数个字符，因为每个字节由两个十六进制字符表示
@@ -148,6 +265,46 @@ func SignWithRSA(privateKey *rsa.PrivateKey, message []byte) ([]byte, error) {
 	return signature, nil
 }
 
+// 混合加密中 RSA 包裹的随机 AES 密钥长度
+const hybridKeySize = 32
+
+// EncryptHybridRSA 混合加密：随机 AES-256 密钥加密数据(AES-GCM)，再用 RSA-OAEP 包裹该密钥
+// 输出格式: 包裹密钥长度(2字节,大端) + 包裹后的密钥 + AES-GCM密文
+func EncryptHybridRSA(publicKey *rsa.PublicKey, plainText []byte) ([]byte, error) {
+	sessionKey := make([]byte, hybridKeySize)
+	if _, err := io.ReadFull(rand.Reader, sessionKey); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, sessionKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("包裹密钥失败: %v", err)
+	}
+	body, err := AESGCMEncode(plainText, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 2, 2+len(wrappedKey)+len(body))
+	binary.BigEndian.PutUint16(out, uint16(len(wrappedKey)))
+	out = append(out, wrappedKey...)
+	return append(out, body...), nil
+}
+
+// DecryptHybridRSA 解密 EncryptHybridRSA 的输出
+func DecryptHybridRSA(privateKey *rsa.PrivateKey, cipherText []byte) ([]byte, error) {
+	if len(cipherText) < 2 {
+		return nil, errors.New("cipherText too short")
+	}
+	keyLen := int(binary.BigEndian.Uint16(cipherText))
+	if len(cipherText) < 2+keyLen {
+		return nil, errors.New("cipherText too short")
+	}
+	sessionKey, err := DecryptPrivateRSA(privateKey, cipherText[2:2+keyLen])
+	if err != nil {
+		return nil, fmt.Errorf("解包密钥失败: %v", err)
+	}
+	return AESGCMDecode(cipherText[2+keyLen:], sessionKey)
+}
+
 // 使用私钥解密数据
 func DecryptPrivateRSA(privKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
 	// 解密：使用私钥解密加密的文本
@@ -0,0 +1,372 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 导出与导入，用于在标准工具中查看流量或附在报告中
+// 非 UTF-8 的请求体以 base64 保存在 postData.text 中并以 _encoding 标记，响应体使用标准的 content.encoding
+// 以 _ 开头的字段为HAR允许的自定义字段
+
+// HarVersion 导出的HAR版本
+const HarVersion = "1.2"
+
+// harBase64Prefix 非 UTF-8 明文以文本显示时的前缀
+const harBase64Prefix = "base64:"
+
+// harTruncated 报文被截断保存的条目的注释
+const harTruncated = "body truncated"
+
+type HAR struct {
+	Log HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // 毫秒
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+	RequestID       int64       `json:"_requestId,omitempty"`
+	SessionID       int64       `json:"_sessionId,omitempty"`
+	ShellID         int64       `json:"_shellId,omitempty"`
+	Operation       string      `json:"_operation,omitempty"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"` // 编码前的请求明文
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"` // 解码后的响应明文
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HarOptions 导出选项，按 TrafficQuery 筛选流量
+type HarOptions struct {
+	TrafficQuery
+	Plaintext bool `json:"plaintext"` // 在请求与响应的 comment 中附加编码前/解码后的明文
+}
+
+// ExportHAR 按条件导出缓存中的流量
+func (cm *CacheManager) ExportHAR(opts HarOptions) (*HAR, error) {
+	query := opts.where(cm.db.Model(&HttpCache{})).Order("created_at, id")
+	var rows []HttpCache
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	har := &HAR{Log: HarLog{
+		Version: HarVersion,
+		Creator: HarCreator{Name: "caffeine"}, // 项目没有版本号，creator.version 留空
+		Entries: make([]HarEntry, 0, len(rows)),
+	}}
+	for _, row := range rows {
+		har.Log.Entries = append(har.Log.Entries, harEntry(row, opts.Plaintext))
+	}
+	return har, nil
+}
+
+// WriteHAR 导出流量并以JSON写入 w
+func (cm *CacheManager) WriteHAR(w io.Writer, opts HarOptions) (int, error) {
+	har, err := cm.ExportHAR(opts)
+	if err != nil {
+		return 0, err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return len(har.Log.Entries), encoder.Encode(har)
+}
+
+// ImportHAR 将HAR文件中的条目写入流量缓存，返回导入的条目数
+// 由本程序导出的条目按 _requestId 去重，重复导入时跳过
+func (cm *CacheManager) ImportHAR(r io.Reader) (int, error) {
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return 0, fmt.Errorf("解析HAR失败: %v", err)
+	}
+	imported := 0
+	for i, entry := range har.Log.Entries {
+		row, err := harCache(entry)
+		if err != nil {
+			return imported, fmt.Errorf("第 %d 个条目: %v", i+1, err)
+		}
+		if entry.RequestID != 0 {
+			var count int64
+			if err := cm.db.Model(&HttpCache{}).Where("request_id = ?", entry.RequestID).Count(&count).Error; err != nil {
+				return imported, err
+			}
+			if count > 0 {
+				continue
+			}
+		}
+		if err := cm.db.Create(&row).Error; err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// harEntry 将缓存记录转换为HAR条目
+func harEntry(row HttpCache, plaintext bool) HarEntry {
+	var reqHeaders map[string]string
+	json.Unmarshal(row.ReqHeader, &reqHeaders)
+	var respHeaders http.Header
+	json.Unmarshal(row.RespHeader, &respHeaders)
+
+	reqHeader := make(http.Header, len(reqHeaders))
+	for name, value := range reqHeaders {
+		reqHeader.Set(name, value)
+	}
+
+	entry := HarEntry{
+		StartedDateTime: row.CreatedAt,
+		Time:            float64(row.Duration),
+		Timings:         HarTimings{Wait: float64(row.Duration)},
+		RequestID:       row.RequestID,
+		SessionID:       row.SessionID,
+		ShellID:         row.ShellID,
+		Operation:       row.Operation,
+		Request: HarRequest{
+			Method:      row.Method,
+			URL:         row.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     harCookies((&http.Request{Header: reqHeader}).Cookies()),
+			Headers:     harHeaders(reqHeader),
+			QueryString: harQuery(row.URL),
+			HeadersSize: -1,
+			BodySize:    bodySize(row.ReqSize, row.ReqBody),
+		},
+		Response: HarResponse{
+			Status:      row.RespCode,
+			StatusText:  http.StatusText(row.RespCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     harCookies((&http.Response{Header: respHeaders}).Cookies()),
+			Headers:     harHeaders(respHeaders),
+			RedirectURL: respHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    bodySize(row.RespSize, row.RespBody),
+			Content: HarContent{
+				Size:     bodySize(row.RespSize, row.RespBody),
+				MimeType: mimeType(respHeaders),
+			},
+		},
+	}
+	if row.Truncated {
+		entry.Comment = harTruncated
+	}
+	if len(row.ReqBody) > 0 {
+		text, encoding := harText(row.ReqBody)
+		entry.Request.PostData = &HarPostData{MimeType: mimeType(reqHeader), Text: text, Encoding: encoding}
+	}
+	entry.Response.Content.Text, entry.Response.Content.Encoding = harText(row.RespBody)
+	if plaintext {
+		entry.Request.Comment = displayText(row.ReqPlain)
+		entry.Response.Comment = displayText(row.RespPlain)
+	}
+	return entry
+}
+
+// harCache 将HAR条目转换为缓存记录
+func harCache(entry HarEntry) (HttpCache, error) {
+	reqHeaders := make(map[string]string, len(entry.Request.Headers))
+	for _, header := range entry.Request.Headers {
+		reqHeaders[header.Name] = header.Value
+	}
+	respHeaders := make(http.Header, len(entry.Response.Headers))
+	for _, header := range entry.Response.Headers {
+		respHeaders.Add(header.Name, header.Value)
+	}
+	reqHeader, _ := json.Marshal(reqHeaders)
+	respHeader, _ := json.Marshal(respHeaders)
+
+	row := HttpCache{
+		RequestID:  entry.RequestID,
+		SessionID:  entry.SessionID,
+		ShellID:    entry.ShellID,
+		Operation:  entry.Operation,
+		Method:     entry.Request.Method,
+		URL:        entry.Request.URL,
+		ReqHeader:  reqHeader,
+		RespCode:   entry.Response.Status,
+		RespHeader: respHeader,
+		Duration:   int64(entry.Time),
+		Truncated:  entry.Comment == harTruncated,
+		CreatedAt:  entry.StartedDateTime,
+	}
+	if row.RequestID == 0 {
+		row.RequestID = atomic.AddInt64(&requestID, 1)
+	}
+	var err error
+	if postData := entry.Request.PostData; postData != nil {
+		if row.ReqBody, err = harBody(postData.Text, postData.Encoding); err != nil {
+			return row, err
+		}
+	}
+	if row.RespBody, err = harBody(entry.Response.Content.Text, entry.Response.Content.Encoding); err != nil {
+		return row, err
+	}
+	if row.ReqPlain, err = parseDisplayText(entry.Request.Comment); err != nil {
+		return row, err
+	}
+	if row.RespPlain, err = parseDisplayText(entry.Response.Comment); err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+// bodySize 返回正文原始大小，未记录大小的旧记录使用保存的正文长度
+func bodySize(size int64, body []byte) int {
+	if size > 0 {
+		return int(size)
+	}
+	return len(body)
+}
+
+// harText 返回正文及其编码，非 UTF-8 内容使用 base64
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func harBody(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(text), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return nil, fmt.Errorf("不支持的正文编码: %s", encoding)
+}
+
+// displayText 将明文转换为可显示的文本，非 UTF-8 内容以 base64: 前缀加 base64 表示
+func displayText(plaintext []byte) string {
+	if len(plaintext) == 0 || utf8.Valid(plaintext) {
+		return string(plaintext)
+	}
+	return harBase64Prefix + base64.StdEncoding.EncodeToString(plaintext)
+}
+
+// parseDisplayText 还原 displayText 生成的文本
+func parseDisplayText(comment string) ([]byte, error) {
+	if comment == "" {
+		return nil, nil
+	}
+	if encoded, ok := strings.CutPrefix(comment, harBase64Prefix); ok {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	return []byte(comment), nil
+}
+
+// harHeaders 返回按名称排序的请求头
+func harHeaders(header http.Header) []HarNameValue {
+	values := make([]HarNameValue, 0, len(header))
+	for name, list := range header {
+		for _, value := range list {
+			values = append(values, HarNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harCookies(cookies []*http.Cookie) []HarNameValue {
+	values := make([]HarNameValue, 0, len(cookies))
+	for _, cookie := range cookies {
+		values = append(values, HarNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return values
+}
+
+func harQuery(rawURL string) []HarNameValue {
+	values := make([]HarNameValue, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		values = append(values, HarNameValue{Name: name, Value: value})
+	}
+	return values
+}
+
+func mimeType(header http.Header) string {
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
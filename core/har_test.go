@@ -0,0 +1,68 @@
+package core
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestHARRoundTrip(t *testing.T) {
+	source, err := NewCacheManager(filepath.Join(t.TempDir(), "source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := NewHttpRequest()
+	req.Method, req.URL, req.SessionID = "POST", "http://target/shell.php?a=1&b=x%20y", 42
+	req.Headers = map[string]string{"Cookie": "sid=abc", "Content-Type": "text/plain"}
+	req.Body = []byte("ZW5jb2RlZA==")
+	req.Plaintext = []byte("whoami")
+	req.Response = NewHttpResponse(200, http.Header{"Content-Type": {"application/octet-stream"}}, []byte{0xff, 0x00, 0x01})
+
+	// 明文先于缓存写入到达
+	if err := source.SetResponsePlaintext(req.ID, []byte("root\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SaveToCache(req); err != nil {
+		t.Fatal(err)
+	}
+	other := NewHttpRequest()
+	other.Method, other.URL, other.SessionID, other.Headers = "GET", "http://target/", 7, map[string]string{}
+	other.Response = NewHttpResponse(404, nil, nil)
+	if err := source.SaveToCache(other); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	count, err := source.WriteHAR(&buf, HarOptions{TrafficQuery: TrafficQuery{SessionID: 42}, Plaintext: true})
+	if err != nil || count != 1 {
+		t.Fatalf("export returned %d entries: %v", count, err)
+	}
+	har, _ := source.ExportHAR(HarOptions{TrafficQuery: TrafficQuery{SessionID: 42}, Plaintext: true})
+	entry := har.Log.Entries[0]
+	if entry.Request.Comment != "whoami" || entry.Response.Comment != "root\n" {
+		t.Fatalf("plaintext missing from comments: %q %q", entry.Request.Comment, entry.Response.Comment)
+	}
+	if entry.Response.Content.Encoding != "base64" || len(entry.Request.Cookies) != 1 || len(entry.Request.QueryString) != 2 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	target, err := NewCacheManager(filepath.Join(t.TempDir(), "target.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if n, err := target.ImportHAR(bytes.NewReader(data)); err != nil || n != 1 {
+		t.Fatalf("import returned %d: %v", n, err)
+	}
+	if n, err := target.ImportHAR(bytes.NewReader(data)); err != nil || n != 0 {
+		t.Fatalf("duplicate import returned %d: %v", n, err)
+	}
+	imported, err := target.GetFromCache(req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported.Body, req.Body) || !bytes.Equal(imported.Response.Body, req.Response.Body) {
+		t.Fatalf("bodies changed after import: %q %q", imported.Body, imported.Response.Body)
+	}
+}
@@ -2,14 +2,15 @@ package core
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
-	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,14 +21,6 @@ import (
 
 var Http *HttpEngine
 
-// HttpMetrics 用于记录HTTP性能指标
-type HttpMetrics struct {
-	requestCount      int64 // 总请求数
-	errorCount        int64 // 错误请求数
-	totalResponseTime int64 // 总响应时间（毫秒）
-	activeRequests    int32 // 当前活跃请求数
-}
-
 // HttpEngineConfig HTTP引擎配置
 type HttpEngineConfig struct {
 	MaxConns           int           // 最大并发连接数
@@ -49,12 +42,39 @@ type HttpRequest struct {
 	Headers    map[string]string  // 请求头
 	done       bool               // 请求是否完成
 	Body       []byte             // 请求体
+	BodyReader io.Reader          // 流式请求体，不为空时代替 Body，请求失败后不重试
+	Stream     bool               // 流式响应，响应体不读入内存，由调用方读取 Response.BodyReader 并关闭
+	Proxy      string             // 请求使用的代理，为空时按全局代理规则选择，direct 表示直连
+	TLS        *TLSSettings       // 目标的TLS配置，为空时使用默认配置
+	Target     string             // 请求所属的目标，如 ShellKey(id)，用于shell级限速与熔断，为空时按目标主机计算
+	RateLimit  *RateLimitSettings // Target 对应的限速配置
+	SessionID  int64              // 发出请求的会话，记录到流量缓存
+	ShellID    int64              // 请求所属的shell，记录到流量缓存
+	Operation  string             // 发出请求的操作，如 RunCmd，记录到流量缓存
+	NoCache    bool               // 不记录到流量缓存
+	Plaintext  []byte             // 编码前的请求明文，记录到流量缓存
 	Response   *HttpResponse      // 响应对象
 	Err        error              // 错误信息
 	Wg         sync.WaitGroup     // 等待组
 	Callback   func(*HttpRequest) // 回调函数
 	retries    int                // 已重试次数
 	compressed bool               // 是否已压缩
+	started    time.Time          // 最近一次发送的开始时间
+	duration   time.Duration      // 最近一次发送的耗时
+	ctx        context.Context    // 请求上下文，取消后中止请求
+}
+
+// Context 返回请求的上下文，未设置时为 context.Background()
+func (r *HttpRequest) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext 设置请求的上下文，上下文取消后正在进行的请求立即中止，且不再重试
+func (r *HttpRequest) SetContext(ctx context.Context) {
+	r.ctx = ctx
 }
 
 // HttpResponse 响应结构体
@@ -63,12 +83,35 @@ type HttpResponse struct {
 	code    int            // 状态码
 	Headers http.Header    // 响应头
 	Body    []byte         // 响应体
+	// 流式响应体，仅在请求设置 Stream 时有值，关闭后释放连接
+	BodyReader io.ReadCloser
+}
+
+// NewHttpResponse 根据状态码、响应头和响应体构造响应
+func NewHttpResponse(code int, headers http.Header, body []byte) *HttpResponse {
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	return &HttpResponse{
+		code:    code,
+		Headers: headers,
+		Body:    body,
+	}
+}
+
+// StatusCode 返回响应状态码
+func (r *HttpResponse) StatusCode() int {
+	return r.code
 }
 
 // HttpEngine HTTP引擎核心结构体
 type HttpEngine struct {
 	client          *http.Client                      // HTTP客户端
+	streamClient    *http.Client                      // 流式传输客户端，不限制整体耗时
+	transport       *targetTransport                  // 按代理与TLS配置区分的传输层
 	sem             *semaphore.Weighted               // 信号量，用于限制并发
+	limiter         *RateLimiter                      // 按目标主机与shell限速
+	breaker         *CircuitBreaker                   // 按目标熔断
 	maxRetries      int                               // 最大重试次数
 	poolSize        int                               // 工作池大小
 	tasks           chan *HttpRequest                 // 任务通道
@@ -80,10 +123,10 @@ type HttpEngine struct {
 	errorHandlers   map[int]func(*HttpResponse) error // 错误处理器映射
 	retryableCodes  map[int]bool                      // 可重试的状态码
 	chunkConfig     *ChunkConfig                      // 分块配置
-	transferMetrics *TransferMetrics                  // 传输指标
+	transferMetrics atomic.Pointer[TransferMetrics]   // 分块传输指标，初始化分块传输时替换
 	cacheManager    *CacheManager                     // 缓存管理器
-	metricsChan     chan metricsData                  // 指标数据通道
 	cacheChan       chan *HttpRequest                 // 缓存请求通道
+	droppedCache    int64                             // 缓存队列已满而未记录的请求数
 }
 
 // 通用头部模板
@@ -116,6 +159,19 @@ func (e *HttpError) Error() string {
 	return fmt.Sprintf("HTTP Error %d: %s", e.Code, e.Message)
 }
 
+// Unwrap 返回底层错误，可用 errors.Is(err, context.Canceled) 判断请求是否被取消
+func (e *HttpError) Unwrap() error {
+	return e.Err
+}
+
+// ErrLocalConfig 请求因本地配置错误(如TLS、代理配置无效)未能发出，与目标是否可用无关
+var ErrLocalConfig = errors.New("local configuration error")
+
+// localConfigError 包装本地配置错误，可用 errors.Is(err, ErrLocalConfig) 判断
+func localConfigError(message string, err error) *HttpError {
+	return &HttpError{Code: 0, Message: message, Err: fmt.Errorf("%w: %w", ErrLocalConfig, err)}
+}
+
 // 定义错误码常量
 const (
 	// 4xx Client Errors
@@ -135,12 +191,6 @@ const (
 	ErrGatewayTimeout     = 504
 )
 
-// 用于传递指标数据的结构
-type metricsData struct {
-	duration   time.Duration
-	statusCode int
-}
-
 func NewHttpEngine(config *HttpEngineConfig) *HttpEngine {
 	transport := &http.Transport{
 		MaxIdleConns:        100,
@@ -151,17 +201,13 @@ func NewHttpEngine(config *HttpEngineConfig) *HttpEngine {
 		MaxIdleConnsPerHost: config.MaxConns / 2,
 	}
 
-	// 设置代理选择器
+	// 按请求选择代理与TLS配置，不同的代理与TLS配置各自使用独立的连接池
 	basicCfg := GetInstance()
-	if basicCfg.Proxy.Enabled && len(basicCfg.Proxy.ProxyPool) > 0 {
-		transport.Proxy = func(req *http.Request) (*url.URL, error) {
-			proxyURL := basicCfg.Proxy.GetProxyURL(req.URL.Scheme)
-			if proxyURL == "" {
-				return nil, nil
-			}
-			return url.Parse(proxyURL)
-		}
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(basicCfg.Timeout.Dial) * time.Second,
+		KeepAlive: time.Duration(basicCfg.Timeout.KeepAlive) * time.Second,
 	}
+	transports := newTargetTransport(transport, dialer, config.ProxyTimeout)
 
 	// 初始化缓存
 	cacheManager := GetCacheManager()
@@ -172,14 +218,20 @@ func NewHttpEngine(config *HttpEngineConfig) *HttpEngine {
 	engine := &HttpEngine{
 		client: &http.Client{
 			Timeout:   config.Timeout,
-			Transport: transport,
+			Transport: transports,
+		},
+		streamClient: &http.Client{
+			Transport: transports,
 		},
+		transport:     transports,
 		sem:           semaphore.NewWeighted(int64(config.MaxConns)),
+		limiter:       NewRateLimiter(),
+		breaker:       NewCircuitBreaker(GetInstance().circuitBreaker),
 		maxRetries:    config.MaxRetries,
 		poolSize:      config.PoolSize,
 		tasks:         make(chan *HttpRequest, config.PoolSize),
 		logger:        logger,
-		metrics:       &HttpMetrics{},
+		metrics:       newHttpMetrics(),
 		config:        config,
 		patterns:      commonHeaders,
 		errorHandlers: make(map[int]func(*HttpResponse) error),
@@ -192,7 +244,6 @@ func NewHttpEngine(config *HttpEngineConfig) *HttpEngine {
 			504: true, // Gateway Timeout
 		},
 		cacheManager: cacheManager,
-		metricsChan:  make(chan metricsData, 1000), // 缓冲通道
 		cacheChan:    make(chan *HttpRequest, 1000),
 	}
 
@@ -202,7 +253,6 @@ func NewHttpEngine(config *HttpEngineConfig) *HttpEngine {
 	engine.initWorkerPool()
 
 	// 启动异步处理协程
-	go engine.processMetrics()
 	go engine.processCache()
 
 	return engine
@@ -256,42 +306,97 @@ func (engine *HttpEngine) obfuscateRequest(req *HttpRequest) {
 
 // compressBody 压缩请求体
 func compressBody(body []byte) ([]byte, error) {
-	var b bytes.Buffer
-	w := gzip.NewWriter(&b)
-	_, err := w.Write(body)
-	if err != nil {
-		return nil, err
-	}
-	w.Close()
-	return b.Bytes(), nil
+	return GzipEncode(body)
 }
 
 // decompressBody 解压响应体
 func decompressBody(body []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(body))
-	if err != nil {
-		return nil, err
+	return GzipDecode(body)
+}
+
+// 流式请求失败时读取的错误响应体上限
+const maxStreamErrorBody = 1 << 20
+
+// streamResponseBody 流式响应体，关闭时释放连接与并发名额
+type streamResponseBody struct {
+	io.Reader
+	body    io.Closer
+	release func()
+	once    sync.Once
+}
+
+func (s *streamResponseBody) Close() error {
+	err := s.body.Close()
+	s.once.Do(s.release)
+	return err
+}
+
+// streamBody 返回响应体读取器，gzip 响应边读边解压
+func streamBody(resp *http.Response, body io.Reader) (io.Reader, error) {
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		return NewGzipReader(body)
 	}
-	defer reader.Close()
-	return ioutil.ReadAll(reader)
+	return body, nil
+}
+
+// countingReader 统计读取的字节数，可在其他协程中读取计数
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+// Count 已读取的字节数
+func (r *countingReader) Count() int64 {
+	return atomic.LoadInt64(&r.n)
 }
 
 // ExecuteRequest 执行HTTP请求，支持重试机制
 func (engine *HttpEngine) ExecuteRequest(req *HttpRequest) error {
+	return engine.ExecuteRequestContext(req.Context(), req)
+}
+
+// ExecuteRequestContext 使用指定上下文执行HTTP请求，上下文取消时中止请求与重试等待
+func (engine *HttpEngine) ExecuteRequestContext(ctx context.Context, req *HttpRequest) error {
+	req.ctx = ctx
 	var lastErr error
 	backoff := engine.config.RetryInterval // 初始重试间隔
+	key := breakerKey(req)
 
 	// 重试循环
 	for attempt := 0; attempt <= engine.maxRetries; attempt++ {
 		if attempt > 0 {
-			time.Sleep(backoff)
+			// 目标已熔断时不再等待重试
+			if engine.breaker.State(key) == BreakerOpen {
+				return &HttpError{Code: 0, Message: "Target unavailable", Err: ErrCircuitOpen}
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return &HttpError{Code: 0, Message: "Request cancelled", Err: ctx.Err()}
+			case <-timer.C:
+			}
 			backoff = time.Duration(float64(backoff) * 1.5) // 指数退避策略
 		}
 
-		err := engine.executeRequestOnce(req)
+		if err := engine.breaker.Allow(key); err != nil {
+			return &HttpError{Code: 0, Message: "Target unavailable", Err: err}
+		}
+		err := engine.executeRequestOnce(ctx, req)
+		engine.recordOutcome(ctx, key, err)
 		if err == nil {
 			return nil
 		}
+		// 流式请求体已被读取，无法重放；已取消的请求与本地配置错误不再重试
+		if req.BodyReader != nil || ctx.Err() != nil || errors.Is(err, ErrLocalConfig) {
+			return err
+		}
 
 		// 检查错误是否可重试
 		if httpErr, ok := err.(*HttpError); ok {
@@ -310,17 +415,41 @@ func (engine *HttpEngine) ExecuteRequest(req *HttpRequest) error {
 	return fmt.Errorf("max retries exceeded: %v", lastErr)
 }
 
-func (engine *HttpEngine) executeRequestOnce(req *HttpRequest) error {
-	ctx := context.Background()
+func (engine *HttpEngine) executeRequestOnce(ctx context.Context, req *HttpRequest) (err error) {
+	keys, limits := engine.rateLimits(req)
+	releaseLimit, err := engine.limiter.Wait(ctx, keys, limits)
+	if err != nil {
+		return &HttpError{Code: 0, Message: "Rate limit wait cancelled", Err: err}
+	}
 	if err := engine.sem.Acquire(ctx, 1); err != nil {
+		releaseLimit()
 		return &HttpError{Code: 0, Message: "Failed to acquire semaphore", Err: err}
 	}
-	defer engine.sem.Release(1)
-
 	atomic.AddInt32(&engine.metrics.activeRequests, 1)
-	defer atomic.AddInt32(&engine.metrics.activeRequests, -1)
+	// 流式响应在调用方关闭响应体时才释放并发名额
+	release := func() {
+		atomic.AddInt32(&engine.metrics.activeRequests, -1)
+		engine.sem.Release(1)
+		releaseLimit()
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			release()
+		}
+	}()
 
+	// 每次发送记录一次指标，出错或返回错误状态码时计为错误
+	// 除流式响应与被取消的请求外，失败的交互同样记录到流量缓存，无需重新发送即可排查
 	start := time.Now()
+	var resp *http.Response
+	defer func() {
+		req.started, req.duration = start, time.Since(start)
+		engine.metrics.observe(breakerKey(req), req.Operation, req.duration, err != nil)
+		if !streaming && ctx.Err() == nil {
+			engine.cache(req, resp)
+		}
+	}()
 
 	// 流量混淆
 	engine.obfuscateRequest(req)
@@ -335,38 +464,49 @@ func (engine *HttpEngine) executeRequestOnce(req *HttpRequest) error {
 	//	}
 	//}
 
-	// 构建请求
-	httpReq, err := http.NewRequest(req.Method, req.URL, bytes.NewBuffer(req.Body))
-	if err != nil {
-		return &HttpError{Code: 0, Message: "Failed to create request", Err: err}
-	}
-
-	// 设置请求头
-	for key, value := range req.Headers {
-		httpReq.Header.Set(key, value)
-	}
-
 	// 发送请求
-	resp, err := engine.client.Do(httpReq)
+	resp, err = engine.send(ctx, req)
 	if err != nil {
-		// 异步记录错误指标
-		go func() {
-			engine.metricsChan <- metricsData{
-				duration:   time.Since(start),
-				statusCode: 0,
-			}
-		}()
-		return &HttpError{Code: 0, Message: "Request failed", Err: err}
+		return err
 	}
 
 	if resp == nil {
 		return &HttpError{Code: 0, Message: "Empty response", Err: nil}
 	}
 
+	// 成功的流式响应交给调用方读取
+	if req.Stream && resp.StatusCode < 400 {
+		counter := &countingReader{Reader: resp.Body}
+		reader, err := streamBody(resp, counter)
+		if err != nil {
+			resp.Body.Close()
+			return &HttpError{Code: resp.StatusCode, Message: "Failed to decompress response", Err: err}
+		}
+		streaming = true
+		// 流式响应体的字节数在调用方关闭时记录
+		closeStream := func() {
+			engine.metrics.transfer(breakerKey(req), req.Operation, 0, counter.Count())
+			release()
+		}
+		req.Response = &HttpResponse{
+			raw:        resp,
+			code:       resp.StatusCode,
+			Headers:    resp.Header,
+			BodyReader: &streamResponseBody{Reader: reader, body: resp.Body, release: closeStream},
+		}
+		req.done = true
+		return nil
+	}
+
 	defer resp.Body.Close()
 
-	// 读取响应体
-	body, err := ioutil.ReadAll(resp.Body)
+	// 读取响应体，流式请求出错时只保留错误页面的前一部分
+	var reader io.Reader = resp.Body
+	if req.Stream {
+		reader = io.LimitReader(resp.Body, maxStreamErrorBody)
+	}
+	body, err := ioutil.ReadAll(reader)
+	engine.metrics.transfer(breakerKey(req), req.Operation, 0, int64(len(body)))
 	if err != nil {
 		return &HttpError{Code: resp.StatusCode, Message: "Failed to read response body", Err: err}
 	}
@@ -388,7 +528,7 @@ func (engine *HttpEngine) executeRequestOnce(req *HttpRequest) error {
 
 	// 处理错误状态码
 	if resp.StatusCode >= 400 {
-		atomic.AddInt64(&engine.metrics.errorCount, 1)
+		engine.throttle(keys, resp)
 
 		if handler, exists := engine.errorHandlers[resp.StatusCode]; exists {
 			return handler(req.Response)
@@ -412,38 +552,68 @@ func (engine *HttpEngine) executeRequestOnce(req *HttpRequest) error {
 	}
 
 	req.done = true
+	return nil
+}
 
-	// 更新指标
-	duration := time.Since(start)
-	atomic.AddInt64(&engine.metrics.requestCount, 1)
-	atomic.AddInt64(&engine.metrics.totalResponseTime, duration.Milliseconds())
-
-	if req.done {
-		// 异步发送性能指标
-		go func() {
-			engine.metricsChan <- metricsData{
-				duration:   duration,
-				statusCode: resp.StatusCode,
-			}
-		}()
+// send 构建并发送请求，经代理池发送的请求在代理出错时换用池中其他代理重新发送
+// 流式请求体无法重放，不切换代理
+func (engine *HttpEngine) send(ctx context.Context, req *HttpRequest) (*http.Response, error) {
+	// 流式传输的耗时与数据大小相关，不使用整体超时
+	client := engine.client
+	if req.Stream || req.BodyReader != nil {
+		client = engine.streamClient
+	}
 
-		// 异步处理缓存
-		go func() {
-			engine.cacheChan <- req
-		}()
+	// TLS配置错误与代理无关，在选择代理前检查
+	if _, err := engine.transport.tlsConfig(req.TLS); err != nil {
+		return nil, localConfigError("Invalid TLS config", err)
 	}
+	ctx = withTLS(ctx, req.TLS)
 
-	return nil
-}
+	var tried []string
+	for {
+		proxy, pooled, err := engine.resolveProxy(req, tried)
+		if err != nil {
+			return nil, localConfigError("Invalid proxy", err)
+		}
+		// 流式请求体长度未知，读取时计数
+		var reqBody io.Reader = bytes.NewReader(req.Body)
+		var counter *countingReader
+		if req.BodyReader != nil {
+			counter = &countingReader{Reader: req.BodyReader}
+			reqBody = counter
+		}
+		httpReq, err := http.NewRequestWithContext(withProxy(ctx, proxy), req.Method, req.URL, reqBody)
+		if err != nil {
+			return nil, localConfigError("Failed to create request", err)
+		}
+		// 设置请求头
+		for key, value := range req.Headers {
+			httpReq.Header.Set(key, value)
+		}
 
-// 异步处理性能指标
-func (engine *HttpEngine) processMetrics() {
-	for data := range engine.metricsChan {
-		atomic.AddInt64(&engine.metrics.requestCount, 1)
-		atomic.AddInt64(&engine.metrics.totalResponseTime, data.duration.Milliseconds())
-		if data.statusCode >= 400 {
-			atomic.AddInt64(&engine.metrics.errorCount, 1)
+		sent := time.Now()
+		resp, err := client.Do(httpReq)
+		if counter != nil {
+			engine.metrics.transfer(breakerKey(req), req.Operation, counter.Count(), 0)
+		} else if err == nil {
+			engine.metrics.transfer(breakerKey(req), req.Operation, int64(len(req.Body)), 0)
 		}
+		if err == nil {
+			if pooled {
+				GetProxyPool().ReportSuccess(proxy, time.Since(sent))
+			}
+			return resp, nil
+		}
+		if !pooled || ctx.Err() != nil {
+			return nil, &HttpError{Code: 0, Message: "Request failed", Err: err}
+		}
+		GetProxyPool().ReportFailure(proxy, err)
+		tried = append(tried, proxy.String())
+		if req.BodyReader != nil || len(tried) >= GetProxyPool().Len() {
+			return nil, &HttpError{Code: 0, Message: "Request failed", Err: err}
+		}
+		engine.logger.Warnf("Request %d via proxy %s failed, switching proxy: %v", req.ID, proxy.Redacted(), err)
 	}
 }
 
@@ -459,7 +629,6 @@ func (engine *HttpEngine) processCache() {
 // StopAndWait 优雅关闭HTTP引擎
 func (engine *HttpEngine) StopAndWait() {
 	// 关闭所有通道
-	close(engine.metricsChan)
 	close(engine.cacheChan)
 
 	// 等待所有工作协程完成
@@ -637,9 +806,9 @@ type TransferMetrics struct {
 // 扩展 HttpEngine
 func (engine *HttpEngine) InitChunkTransfer(config ChunkConfig) {
 	engine.chunkConfig = &config
-	engine.transferMetrics = &TransferMetrics{
+	engine.transferMetrics.Store(&TransferMetrics{
 		StartTime: time.Now(),
-	}
+	})
 }
 
 // 处理分块请求
@@ -713,32 +882,37 @@ func (engine *HttpEngine) ProcessChunks(chunks []*ChunkRequest) error {
 
 // 更新传输指标
 func (engine *HttpEngine) updateTransferMetrics(sent, received int64) {
-	engine.transferMetrics.mu.Lock()
-	defer engine.transferMetrics.mu.Unlock()
+	metrics := engine.transferMetrics.Load()
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
 
-	atomic.AddInt64(&engine.transferMetrics.BytesSent, sent)
-	atomic.AddInt64(&engine.transferMetrics.BytesReceived, received)
-	atomic.AddInt64(&engine.transferMetrics.ChunksProcessed, 1)
+	atomic.AddInt64(&metrics.BytesSent, sent)
+	atomic.AddInt64(&metrics.BytesReceived, received)
+	atomic.AddInt64(&metrics.ChunksProcessed, 1)
 }
 
 func (engine *HttpEngine) incrementFailedChunks() {
-	atomic.AddInt64(&engine.transferMetrics.FailedChunks, 1)
+	atomic.AddInt64(&engine.transferMetrics.Load().FailedChunks, 1)
 }
 
 // 获取传输状态
 func (engine *HttpEngine) GetTransferStatus() map[string]interface{} {
-	engine.transferMetrics.mu.RLock()
-	defer engine.transferMetrics.mu.RUnlock()
+	metrics := engine.transferMetrics.Load()
+	if metrics == nil {
+		return nil
+	}
+	metrics.mu.RLock()
+	defer metrics.mu.RUnlock()
 
-	duration := time.Since(engine.transferMetrics.StartTime).Seconds()
-	bytesSent := atomic.LoadInt64(&engine.transferMetrics.BytesSent)
-	bytesReceived := atomic.LoadInt64(&engine.transferMetrics.BytesReceived)
+	duration := time.Since(metrics.StartTime).Seconds()
+	bytesSent := atomic.LoadInt64(&metrics.BytesSent)
+	bytesReceived := atomic.LoadInt64(&metrics.BytesReceived)
 
 	return map[string]interface{}{
 		"bytes_sent":       bytesSent,
 		"bytes_received":   bytesReceived,
-		"chunks_processed": atomic.LoadInt64(&engine.transferMetrics.ChunksProcessed),
-		"failed_chunks":    atomic.LoadInt64(&engine.transferMetrics.FailedChunks),
+		"chunks_processed": atomic.LoadInt64(&metrics.ChunksProcessed),
+		"failed_chunks":    atomic.LoadInt64(&metrics.FailedChunks),
 		"upload_speed":     float64(bytesSent) / duration,
 		"download_speed":   float64(bytesReceived) / duration,
 		"duration_seconds": duration,
@@ -747,9 +921,11 @@ func (engine *HttpEngine) GetTransferStatus() map[string]interface{} {
 
 // 优化连接池配置
 func (engine *HttpEngine) optimizeConnectionPool() {
-	engine.client.Transport.(*http.Transport).MaxIdleConns = engine.chunkConfig.Concurrency * 2
-	engine.client.Transport.(*http.Transport).MaxIdleConnsPerHost = engine.chunkConfig.Concurrency
-	engine.client.Transport.(*http.Transport).IdleConnTimeout = 30 * time.Second
+	engine.transport.configure(func(t *http.Transport) {
+		t.MaxIdleConns = engine.chunkConfig.Concurrency * 2
+		t.MaxIdleConnsPerHost = engine.chunkConfig.Concurrency
+		t.IdleConnTimeout = 30 * time.Second
+	})
 }
 
 // InitDefaultChunkTransfer 使用默认配置初始化分块传输
@@ -782,12 +958,26 @@ func (engine *HttpEngine) AutoInitChunkTransfer(contentLength int64) bool {
 
 	// 内容较小，不需要分块
 	engine.chunkConfig = nil
-	engine.transferMetrics = nil
+	engine.transferMetrics.Store(nil)
 	return false
 }
 
+// requestID 请求ID计数器，以启动时间为初始值，避免与之前运行时缓存的请求重复
+var requestID = time.Now().UnixMicro()
+
+// NewHttpRequest 创建带有唯一ID的请求
 func NewHttpRequest() *HttpRequest {
-	return &HttpRequest{}
+	return &HttpRequest{ID: atomic.AddInt64(&requestID, 1)}
+}
+
+// RecordResponsePlaintext 记录请求解码后的响应明文到流量缓存
+func (engine *HttpEngine) RecordResponsePlaintext(req *HttpRequest, plaintext []byte) {
+	if req.NoCache || !GetInstance().trafficCache().Enabled {
+		return
+	}
+	if err := engine.cacheManager.SetResponsePlaintext(req.ID, plaintext); err != nil {
+		engine.logger.Warnf("Failed to record plaintext of request %d: %v", req.ID, err)
+	}
 }
 
 // 添加缓存查询方法
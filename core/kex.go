@@ -0,0 +1,83 @@
+package core
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// 会话密钥协商(X25519)，静态密钥仅用于认证双方的临时公钥
+
+const (
+	KexClientLabel = "caffeine-kex-client" // 客户端公钥认证标签
+	KexServerLabel = "caffeine-kex-server" // 服务端公钥认证标签
+	KexInfo        = "caffeine-session"    // HKDF info
+	SessionKeySize = 64                    // 派生密钥长度：前32字节用于AES，后32字节用于XOR
+)
+
+// KeyExchange 一次性的 X25519 密钥对
+type KeyExchange struct {
+	private *ecdh.PrivateKey
+}
+
+// NewKeyExchange 生成临时密钥对
+func NewKeyExchange() (*KeyExchange, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyExchange{private: private}, nil
+}
+
+// PublicKey 返回32字节公钥
+func (k *KeyExchange) PublicKey() []byte {
+	return k.private.PublicKey().Bytes()
+}
+
+// DeriveKey 与对端公钥协商共享密钥，并通过 HKDF-SHA256 派生会话密钥
+// salt 约定为 客户端公钥+服务端公钥，与PHP端 hash_hkdf 保持一致
+func (k *KeyExchange) DeriveKey(peerPublic, salt []byte) ([]byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, fmt.Errorf("无效的对端公钥: %v", err)
+	}
+	shared, err := k.private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	return HKDF(shared, salt, []byte(KexInfo), SessionKeySize), nil
+}
+
+// KexMAC 使用静态密钥计算 HMAC-SHA256(label + parts...)
+func KexMAC(authKey []byte, label string, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, authKey)
+	mac.Write([]byte(label))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return mac.Sum(nil)
+}
+
+// HKDF RFC 5869 HKDF-SHA256
+func HKDF(secret, salt, info []byte, size int) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	out := make([]byte, 0, size)
+	var block []byte
+	for counter := byte(1); len(out) < size; counter++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write(info)
+		expand.Write([]byte{counter})
+		block = expand.Sum(nil)
+		out = append(out, block...)
+	}
+	return out[:size]
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHKDF(t *testing.T) {
+	// RFC 5869 Test Case 1
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+	if got := hex.EncodeToString(HKDF(ikm, salt, info, 42)); got != expected {
+		t.Fatalf("unexpected okm: %s", got)
+	}
+}
+
+func TestKeyExchange(t *testing.T) {
+	client, _ := NewKeyExchange()
+	server, _ := NewKeyExchange()
+	salt := append(client.PublicKey(), server.PublicKey()...)
+	clientKey, err := client.DeriveKey(server.PublicKey(), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, err := server.DeriveKey(client.PublicKey(), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientKey) != SessionKeySize || !bytes.Equal(clientKey, serverKey) {
+		t.Fatal("derived keys mismatch")
+	}
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 请求指标：按目标(shell 或主机)与 hook 方法统计请求数、错误数与耗时分布，
+// 以 Prometheus 文本格式在本机地址导出，界面通过 HttpEngine.Metrics 轮询
+
+// latencyBuckets 耗时直方图各区间的上界(秒)
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsSettings 指标导出配置
+type MetricsSettings struct {
+	Listen string `yaml:"listen"` // Prometheus 指标导出地址，如 127.0.0.1:9464，为空时不导出
+}
+
+// HttpMetrics 用于记录HTTP性能指标
+type HttpMetrics struct {
+	activeRequests int32                    // 当前活跃请求数
+	mu             sync.Mutex               // 保护以下统计
+	total          requestStats             // 所有请求
+	targets        map[string]*requestStats // 按目标统计
+	operations     map[string]*requestStats // 按 hook 方法统计
+}
+
+// requestStats 一组请求的计数与耗时分布
+type requestStats struct {
+	requests      int64
+	errors        int64
+	counts        []int64 // 落在各区间的请求数，最后一项为超过最大上界的请求数
+	sum           time.Duration
+	bytesSent     int64 // 请求体字节数
+	bytesReceived int64 // 响应体字节数(解压前)
+}
+
+// Histogram 耗时直方图
+type Histogram struct {
+	Buckets []float64 `json:"buckets"` // 各区间上界(秒)
+	Counts  []int64   `json:"counts"`  // 耗时不超过对应上界的请求数(累计)
+	Sum     float64   `json:"sum"`     // 总耗时(秒)
+	Count   int64     `json:"count"`
+}
+
+// RequestStats 一组请求的统计
+type RequestStats struct {
+	Requests      int64     `json:"requests"`
+	Errors        int64     `json:"errors"`
+	Latency       Histogram `json:"latency"`
+	BytesSent     int64     `json:"bytesSent"`
+	BytesReceived int64     `json:"bytesReceived"`
+}
+
+// TransferStats 传输统计，字节数包含全部请求，块数只统计分块传输
+type TransferStats struct {
+	BytesSent       int64 `json:"bytesSent"`
+	BytesReceived   int64 `json:"bytesReceived"`
+	ChunksProcessed int64 `json:"chunksProcessed"`
+	FailedChunks    int64 `json:"failedChunks"`
+}
+
+// MetricsSnapshot 某一时刻的指标
+type MetricsSnapshot struct {
+	RequestStats
+	Active       int32                   `json:"active"`       // 当前活跃请求数
+	Targets      map[string]RequestStats `json:"targets"`      // 按目标统计，键为 shell:<id> 或 host:<主机>
+	Operations   map[string]RequestStats `json:"operations"`   // 按 hook 方法统计
+	Transfer     TransferStats           `json:"transfer"`     // 分块传输统计
+	DroppedCache int64                   `json:"droppedCache"` // 缓存队列已满而未记录的请求数
+}
+
+func newHttpMetrics() *HttpMetrics {
+	return &HttpMetrics{
+		targets:    make(map[string]*requestStats),
+		operations: make(map[string]*requestStats),
+	}
+}
+
+// observe 记录一次请求，每次发送(含重试)记录一次
+func (m *HttpMetrics) observe(target, operation string, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.observe(duration, failed)
+	stats(m.targets, target).observe(duration, failed)
+	if operation != "" {
+		stats(m.operations, operation).observe(duration, failed)
+	}
+}
+
+// transfer 记录请求体与响应体在网络上传输的字节数
+func (m *HttpMetrics) transfer(target, operation string, sent, received int64) {
+	if sent == 0 && received == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	groups := []*requestStats{&m.total, stats(m.targets, target)}
+	if operation != "" {
+		groups = append(groups, stats(m.operations, operation))
+	}
+	for _, s := range groups {
+		s.bytesSent += sent
+		s.bytesReceived += received
+	}
+}
+
+func stats(m map[string]*requestStats, key string) *requestStats {
+	s, ok := m[key]
+	if !ok {
+		s = &requestStats{}
+		m[key] = s
+	}
+	return s
+}
+
+func (s *requestStats) observe(duration time.Duration, failed bool) {
+	if s.counts == nil {
+		s.counts = make([]int64, len(latencyBuckets)+1)
+	}
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	s.sum += duration
+	s.counts[sort.SearchFloat64s(latencyBuckets, duration.Seconds())]++
+}
+
+func (s *requestStats) snapshot() RequestStats {
+	latency := Histogram{
+		Buckets: latencyBuckets,
+		Counts:  make([]int64, len(latencyBuckets)),
+		Sum:     s.sum.Seconds(),
+		Count:   s.requests,
+	}
+	var count int64
+	for i := range latency.Counts {
+		if s.counts != nil {
+			count += s.counts[i]
+		}
+		latency.Counts[i] = count
+	}
+	return RequestStats{Requests: s.requests, Errors: s.errors, Latency: latency, BytesSent: s.bytesSent, BytesReceived: s.bytesReceived}
+}
+
+// Metrics 返回当前的请求与传输指标
+func (engine *HttpEngine) Metrics() MetricsSnapshot {
+	m := engine.metrics
+	m.mu.Lock()
+	snapshot := MetricsSnapshot{
+		RequestStats: m.total.snapshot(),
+		Targets:      make(map[string]RequestStats, len(m.targets)),
+		Operations:   make(map[string]RequestStats, len(m.operations)),
+	}
+	for key, s := range m.targets {
+		snapshot.Targets[key] = s.snapshot()
+	}
+	for key, s := range m.operations {
+		snapshot.Operations[key] = s.snapshot()
+	}
+	m.mu.Unlock()
+
+	snapshot.Active = atomic.LoadInt32(&m.activeRequests)
+	snapshot.DroppedCache = atomic.LoadInt64(&engine.droppedCache)
+	snapshot.Transfer = TransferStats{BytesSent: snapshot.BytesSent, BytesReceived: snapshot.BytesReceived}
+	if transfer := engine.transferMetrics.Load(); transfer != nil {
+		snapshot.Transfer.ChunksProcessed = atomic.LoadInt64(&transfer.ChunksProcessed)
+		snapshot.Transfer.FailedChunks = atomic.LoadInt64(&transfer.FailedChunks)
+	}
+	return snapshot
+}
+
+// labelEscaper 转义 Prometheus 标签值
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus 以 Prometheus 文本格式写出指标
+func (s MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	family := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	sample := func(name, labels string, value interface{}) {
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+		fmt.Fprintf(bw, "%s%s %v\n", name, labels, value)
+	}
+	histogram := func(name, labels string, h Histogram) {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		for i, le := range h.Buckets {
+			sample(name+"_bucket", fmt.Sprintf(`%s%sle="%g"`, labels, sep, le), h.Counts[i])
+		}
+		sample(name+"_bucket", labels+sep+`le="+Inf"`, h.Count)
+		sample(name+"_sum", labels, h.Sum)
+		sample(name+"_count", labels, h.Count)
+	}
+	grouped := func(prefix, label string, groups map[string]RequestStats) {
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		family(prefix+"_requests_total", "counter", "HTTP requests sent, by "+label+".")
+		for _, key := range keys {
+			sample(prefix+"_requests_total", fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(key)), groups[key].Requests)
+		}
+		family(prefix+"_errors_total", "counter", "HTTP requests that failed or returned an error status, by "+label+".")
+		for _, key := range keys {
+			sample(prefix+"_errors_total", fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(key)), groups[key].Errors)
+		}
+		family(prefix+"_request_duration_seconds", "histogram", "HTTP request latency, by "+label+".")
+		for _, key := range keys {
+			histogram(prefix+"_request_duration_seconds", fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(key)), groups[key].Latency)
+		}
+		family(prefix+"_bytes_sent_total", "counter", "Request body bytes sent, by "+label+".")
+		for _, key := range keys {
+			sample(prefix+"_bytes_sent_total", fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(key)), groups[key].BytesSent)
+		}
+		family(prefix+"_bytes_received_total", "counter", "Response body bytes received before decompression, by "+label+".")
+		for _, key := range keys {
+			sample(prefix+"_bytes_received_total", fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(key)), groups[key].BytesReceived)
+		}
+	}
+
+	family("caffeine_http_requests_total", "counter", "HTTP requests sent, including retries.")
+	sample("caffeine_http_requests_total", "", s.Requests)
+	family("caffeine_http_errors_total", "counter", "HTTP requests that failed or returned an error status.")
+	sample("caffeine_http_errors_total", "", s.Errors)
+	family("caffeine_http_active_requests", "gauge", "HTTP requests in flight.")
+	sample("caffeine_http_active_requests", "", s.Active)
+	family("caffeine_http_request_duration_seconds", "histogram", "HTTP request latency.")
+	histogram("caffeine_http_request_duration_seconds", "", s.Latency)
+	grouped("caffeine_http_target", "target", s.Targets)
+	grouped("caffeine_http_operation", "operation", s.Operations)
+	family("caffeine_transfer_bytes_sent_total", "counter", "Request body bytes sent, including retries.")
+	sample("caffeine_transfer_bytes_sent_total", "", s.Transfer.BytesSent)
+	family("caffeine_transfer_bytes_received_total", "counter", "Response body bytes received before decompression.")
+	sample("caffeine_transfer_bytes_received_total", "", s.Transfer.BytesReceived)
+	family("caffeine_transfer_chunks_total", "counter", "Chunks transferred.")
+	sample("caffeine_transfer_chunks_total", "", s.Transfer.ChunksProcessed)
+	family("caffeine_transfer_failed_chunks_total", "counter", "Chunks that failed after all retries.")
+	sample("caffeine_transfer_failed_chunks_total", "", s.Transfer.FailedChunks)
+	family("caffeine_traffic_cache_dropped_total", "counter", "Requests not recorded because the traffic cache queue was full.")
+	sample("caffeine_traffic_cache_dropped_total", "", s.DroppedCache)
+	return bw.Flush()
+}
+
+// MetricsExporter 在本机地址以 Prometheus 文本格式导出HTTP引擎的指标
+type MetricsExporter struct {
+	mu       sync.Mutex
+	listen   string
+	server   *http.Server
+	listener net.Listener
+}
+
+var (
+	metricsExporter *MetricsExporter
+	metricsOnce     sync.Once
+)
+
+// GetMetricsExporter 获取全局指标导出器
+func GetMetricsExporter() *MetricsExporter {
+	metricsOnce.Do(func() {
+		metricsExporter = &MetricsExporter{}
+	})
+	return metricsExporter
+}
+
+// checkLocalAddr 指标不需要认证，只允许监听本机地址
+func checkLocalAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("指标导出地址 %s 不是本机地址", addr)
+}
+
+// Update 按配置启动、重启或停止导出，listen 为空时停止
+func (e *MetricsExporter) Update(listen string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if listen == e.listen {
+		return nil
+	}
+	e.stop()
+	if listen == "" {
+		return nil
+	}
+	if err := checkLocalAddr(listen); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		GetHttpEngine().Metrics().WritePrometheus(w)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	e.listen, e.server, e.listener = listen, server, listener
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warnf("指标导出服务退出: %v", err)
+		}
+	}()
+	logger.Infof("指标导出地址 http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// Addr 实际监听的地址，未导出时为空
+func (e *MetricsExporter) Addr() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.listener == nil {
+		return ""
+	}
+	return e.listener.Addr().String()
+}
+
+// Stop 停止导出
+func (e *MetricsExporter) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stop()
+}
+
+func (e *MetricsExporter) stop() {
+	if e.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		e.server.Shutdown(ctx)
+	}
+	e.listen, e.server, e.listener = "", nil, nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpMetrics(t *testing.T) {
+	engine := &HttpEngine{metrics: newHttpMetrics()}
+	engine.metrics.observe("shell:1", "RunCmd", 30*time.Millisecond, false)
+	engine.metrics.observe("shell:1", "LoadDir", 2*time.Second, true)
+	engine.metrics.observe("host:target", "", 40*time.Second, false)
+	engine.metrics.transfer("shell:1", "RunCmd", 1024, 2048)
+
+	m := engine.Metrics()
+	if m.Requests != 3 || m.Errors != 1 {
+		t.Fatalf("got %d requests and %d errors, want 3 and 1", m.Requests, m.Errors)
+	}
+	if shell := m.Targets["shell:1"]; shell.Requests != 2 || shell.Errors != 1 {
+		t.Fatalf("unexpected target stats %+v", shell)
+	}
+	if len(m.Operations) != 2 || m.Operations["RunCmd"].Requests != 1 {
+		t.Fatalf("unexpected operation stats %+v", m.Operations)
+	}
+	// 0.05 以内 1 个，2.5 以内累计 2 个，超过 30 秒的只计入总数
+	counts := m.Latency.Counts
+	if counts[0] != 1 || counts[5] != 2 || counts[len(counts)-1] != 2 || m.Latency.Count != 3 {
+		t.Fatalf("unexpected histogram %+v", m.Latency)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"caffeine_http_requests_total 3",
+		`caffeine_http_target_errors_total{target="shell:1"} 1`,
+		`caffeine_http_operation_request_duration_seconds_bucket{operation="LoadDir",le="2.5"} 1`,
+		`caffeine_http_request_duration_seconds_bucket{le="+Inf"} 3`,
+		"caffeine_transfer_bytes_received_total 2048",
+		`caffeine_http_target_bytes_sent_total{target="shell:1"} 1024`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestMetricsExporter(t *testing.T) {
+	exporter := &MetricsExporter{}
+	if err := exporter.Update("0.0.0.0:9464"); err == nil {
+		t.Fatal("non-local address accepted")
+	}
+	if err := exporter.Update("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if exporter.Addr() == "" {
+		t.Fatal("exporter not listening")
+	}
+	if err := exporter.Update(""); err != nil || exporter.Addr() != "" {
+		t.Fatalf("exporter not stopped: %v", err)
+	}
+}
+
+func TestHttpMetricsTransferBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, "0123456789")
+	}))
+	defer server.Close()
+	engine := NewHttpEngine(&HttpEngineConfig{MaxConns: 2, PoolSize: 1, Timeout: 5 * time.Second})
+
+	req := NewHttpRequest()
+	req.Method, req.URL, req.Headers, req.Target = "POST", server.URL, map[string]string{}, ShellKey(7)
+	req.Body, req.NoCache = []byte("whoami"), true
+	if err := engine.ExecuteRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// 流式请求体与响应体在读取与关闭时计数
+	stream := NewHttpRequest()
+	stream.Method, stream.URL, stream.Headers, stream.Target = "POST", server.URL, map[string]string{}, ShellKey(7)
+	stream.BodyReader, stream.Stream, stream.NoCache = strings.NewReader("upload"), true, true
+	if err := engine.ExecuteRequest(stream); err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, stream.Response.BodyReader)
+	stream.Response.BodyReader.Close()
+
+	m := engine.Metrics()
+	if target := m.Targets[ShellKey(7)]; target.BytesSent != 12 || target.BytesReceived != 20 {
+		t.Fatalf("unexpected target bytes %+v", target)
+	}
+	if m.Transfer.BytesSent != 12 || m.Transfer.BytesReceived != 20 {
+		t.Fatalf("unexpected transfer stats %+v", m.Transfer)
+	}
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 代理选择与SOCKS拨号
+// 每个请求在发送前确定一次代理并放入请求上下文，由 targetTransport 交给对应代理的 Transport 发送
+
+// ProxyDirect 请求级代理设置为该值时不使用任何代理
+const ProxyDirect = "direct"
+
+// 支持的代理协议
+var ProxySchemes = []string{"http", "https", "socks4", "socks4a", "socks5", "socks5h"}
+
+type proxyContextKey struct{}
+
+// withProxy 将请求使用的代理放入上下文，nil 表示直连
+func withProxy(ctx context.Context, proxy *url.URL) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, proxy)
+}
+
+func proxyFromContext(ctx context.Context) *url.URL {
+	proxy, _ := ctx.Value(proxyContextKey{}).(*url.URL)
+	return proxy
+}
+
+// ParseProxyURL 解析代理地址，未带协议时视为HTTP代理
+func ParseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址缺少主机: %s", proxy)
+	}
+	for _, scheme := range ProxySchemes {
+		if u.Scheme == scheme {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+}
+
+// socksURL 返回配置中的SOCKS代理地址，未带协议时按 SocksVer 补全
+func (p *ProxySettings) socksURL() string {
+	if p.SocksProxy == "" || strings.Contains(p.SocksProxy, "://") {
+		return p.SocksProxy
+	}
+	if p.SocksVer == 4 {
+		return "socks4://" + p.SocksProxy
+	}
+	return "socks5://" + p.SocksProxy
+}
+
+// ResolveProxy 按代理规则确定访问 target 使用的代理，返回 nil 表示直连
+// 代理地址未携带认证信息时使用配置中的用户名密码
+func (p *ProxySettings) ResolveProxy(target *url.URL) (*url.URL, error) {
+	proxy, _, err := p.resolveProxy(target, nil)
+	return proxy, err
+}
+
+// resolveProxy 同 ResolveProxy，配置了代理池时从全局代理池中选择 exclude 以外的代理，pooled 表示代理来自代理池
+func (p *ProxySettings) resolveProxy(target *url.URL, exclude []string) (proxy *url.URL, pooled bool, err error) {
+	if !p.ShouldUseProxy(target.Hostname()) {
+		return nil, false, nil
+	}
+	if len(p.ProxyPool) > 0 {
+		if proxy = GetProxyPool().Next(exclude); proxy == nil {
+			return nil, true, fmt.Errorf("代理池中没有可用的代理")
+		}
+		return proxy, true, nil
+	}
+	u, err := p.proxyURL(target)
+	return u, false, err
+}
+
+// proxyURL 按协议选择单个代理
+func (p *ProxySettings) proxyURL(target *url.URL) (*url.URL, error) {
+	proxy := p.GetProxyURL(target.Scheme)
+	if proxy == "" {
+		proxy = p.socksURL()
+	}
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := ParseProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil && p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
+
+// resolveProxy 确定请求使用的代理，请求指定的代理优先于全局配置
+// exclude 为本次请求已失败的代理池代理，pooled 表示代理来自代理池，失败后可切换
+func (engine *HttpEngine) resolveProxy(req *HttpRequest, exclude []string) (proxy *url.URL, pooled bool, err error) {
+	switch req.Proxy {
+	case "":
+	case ProxyDirect:
+		return nil, false, nil
+	default:
+		proxy, err = ParseProxyURL(req.Proxy)
+		return proxy, false, err
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, false, err
+	}
+	return GetInstance().Proxy.resolveProxy(target, exclude)
+}
+
+// proxyAddress 返回代理的 host:port，未指定端口时使用协议的默认端口
+func proxyAddress(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	port := "1080"
+	switch proxy.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// socksDialer 基于标准库实现的SOCKS4/4a/5客户端
+// socks4/socks5 使用请求的上下文在本地解析域名，socks4a/socks5h 由代理解析
+type socksDialer struct {
+	proxy   *url.URL
+	dialer  *net.Dialer
+	timeout time.Duration // 握手超时，0 表示只受上下文限制
+}
+
+func (d *socksDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("socks: 不支持的网络类型 %s", network)
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("socks: 无效的端口 %s", portStr)
+	}
+
+	conn, err := d.dialer.DialContext(ctx, "tcp", proxyAddress(d.proxy))
+	if err != nil {
+		return nil, fmt.Errorf("socks: 连接代理失败: %w", err)
+	}
+	// 握手期间上下文取消或超时则中断连接
+	if d.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.timeout))
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	switch d.proxy.Scheme {
+	case "socks4", "socks4a":
+		err = d.connect4(ctx, conn, host, uint16(port))
+	default:
+		err = d.connect5(ctx, conn, host, uint16(port))
+	}
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// SOCKS4请求: VN CD DSTPORT DSTIP USERID 0 [DOMAIN 0]
+func (d *socksDialer) connect4(ctx context.Context, conn net.Conn, host string, port uint16) error {
+	ip := net.ParseIP(host).To4()
+	var domain string
+	if ip == nil {
+		if d.proxy.Scheme == "socks4a" {
+			ip, domain = net.IPv4(0, 0, 0, 1).To4(), host
+		} else {
+			addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			if err != nil || len(addrs) == 0 {
+				return fmt.Errorf("socks4: 无法解析 %s: %v", host, err)
+			}
+			ip = addrs[0].To4()
+		}
+	}
+	req := []byte{4, 1, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], port)
+	req = append(req, ip...)
+	req = append(req, d.proxy.User.Username()...)
+	req = append(req, 0)
+	if domain != "" {
+		req = append(append(req, domain...), 0)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x5a {
+		return fmt.Errorf("socks4: 代理拒绝连接(0x%02x)", reply[1])
+	}
+	return nil
+}
+
+const (
+	socks5NoAuth       = 0x00
+	socks5UserPass     = 0x02
+	socks5NoAcceptable = 0xff
+)
+
+var socks5Errors = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// SOCKS5: 协商认证方式 -> 用户名密码认证(RFC 1929) -> CONNECT
+func (d *socksDialer) connect5(ctx context.Context, conn net.Conn, host string, port uint16) error {
+	methods := []byte{socks5NoAuth}
+	if d.proxy.User != nil {
+		methods = append(methods, socks5UserPass)
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 {
+		return fmt.Errorf("socks5: 无效的代理版本 %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPass:
+		if d.proxy.User == nil {
+			return errors.New("socks5: 代理要求认证")
+		}
+		user := d.proxy.User.Username()
+		pass, _ := d.proxy.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return errors.New("socks5: 用户名或密码过长")
+		}
+		auth := append([]byte{1, byte(len(user))}, user...)
+		auth = append(append(auth, byte(len(pass))), pass...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("socks5: 用户名或密码错误")
+		}
+	case socks5NoAcceptable:
+		return errors.New("socks5: 没有可用的认证方式")
+	default:
+		return fmt.Errorf("socks5: 不支持的认证方式 0x%02x", reply[1])
+	}
+
+	req := []byte{5, 1, 0}
+	ip := net.ParseIP(host)
+	if ip == nil && d.proxy.Scheme != "socks5h" {
+		addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("socks5: 无法解析 %s: %v", host, err)
+		}
+		ip = addrs[0]
+	}
+	if ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5: 域名过长")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, port)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		if msg, ok := socks5Errors[head[1]]; ok {
+			return fmt.Errorf("socks5: %s", msg)
+		}
+		return fmt.Errorf("socks5: 连接失败(0x%02x)", head[1])
+	}
+	// 跳过绑定地址
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, head[:1]); err != nil {
+			return err
+		}
+		skip = int(head[0])
+	default:
+		return fmt.Errorf("socks5: 无效的地址类型 %d", head[3])
+	}
+	_, err := io.CopyN(io.Discard, conn, int64(skip+2))
+	return err
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestResolveProxy(t *testing.T) {
+	settings := ProxySettings{
+		Enabled:    true,
+		Mode:       "proxy",
+		SocksProxy: "127.0.0.1:1080",
+		SocksVer:   4,
+		Username:   "user",
+		Password:   "pass",
+		NoProxy:    []string{"*.internal"},
+	}
+	proxy, err := settings.ResolveProxy(&url.URL{Scheme: "http", Host: "target.com"})
+	if err != nil || proxy == nil {
+		t.Fatalf("expected proxy, got %v %v", proxy, err)
+	}
+	if proxy.Scheme != "socks4" || proxy.User.Username() != "user" {
+		t.Fatalf("unexpected proxy %s", proxy)
+	}
+	if proxy, _ := settings.ResolveProxy(&url.URL{Scheme: "http", Host: "db.internal"}); proxy != nil {
+		t.Fatalf("no_proxy host should connect directly, got %s", proxy)
+	}
+	settings.Mode = "direct"
+	if proxy, _ := settings.ResolveProxy(&url.URL{Scheme: "http", Host: "target.com"}); proxy != nil {
+		t.Fatalf("direct mode should not use proxy, got %s", proxy)
+	}
+}
+
+// 模拟只接受用户名密码认证的SOCKS5代理，由代理解析域名，握手后回显数据
+func TestSocks5Dialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 512)
+		io.ReadFull(conn, buf[:2])
+		io.ReadFull(conn, buf[:buf[1]])
+		conn.Write([]byte{5, socks5UserPass})
+		io.ReadFull(conn, buf[:2])
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(user) != "user" || string(pass) != "pass" {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+		io.ReadFull(conn, buf[:5]) // VER CMD RSV ATYP LEN
+		host := make([]byte, buf[4])
+		io.ReadFull(conn, host)
+		io.ReadFull(conn, buf[:2])
+		if string(host) != "target.com" || buf[0] != 0 || buf[1] != 80 {
+			conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		io.Copy(conn, conn)
+	}()
+
+	proxy, _ := url.Parse("socks5h://user:pass@" + listener.Addr().String())
+	dialer := &socksDialer{proxy: proxy, dialer: &net.Dialer{}}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "target.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, []byte("ping")) {
+		t.Fatalf("echo failed: %q %v", reply, err)
+	}
+}
+
+// socks5 在本地解析域名后发送IP地址，socks5h 发送域名
+func TestSocks5AddressType(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	atyp := make(chan byte, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4)
+			io.ReadFull(conn, buf[:2])
+			io.ReadFull(conn, buf[:buf[1]])
+			conn.Write([]byte{5, socks5NoAuth})
+			io.ReadFull(conn, buf) // VER CMD RSV ATYP
+			atyp <- buf[3]
+			conn.Write([]byte{5, 2, 0, 1, 0, 0, 0, 0, 0, 0})
+			conn.Close()
+		}
+	}()
+
+	for scheme, want := range map[string][]byte{"socks5": {1, 4}, "socks5h": {3}} {
+		proxy, _ := url.Parse(scheme + "://" + listener.Addr().String())
+		dialer := &socksDialer{proxy: proxy, dialer: &net.Dialer{}}
+		if _, err := dialer.DialContext(context.Background(), "tcp", "localhost:80"); err == nil {
+			t.Fatalf("%s: expected the proxy to refuse the connection", scheme)
+		}
+		if got := <-atyp; !bytes.Contains(want, []byte{got}) {
+			t.Fatalf("%s: address type %d, want one of %v", scheme, got, want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 代理池：轮询/随机/加权选择代理，定期探测代理可用性
+// 连续失败达到上限的代理暂时移出代理池，探测成功后重新加入
+
+// 代理池选择模式
+const (
+	PoolRoundRobin = "round-robin"
+	PoolRandom     = "random"
+	PoolWeight     = "weight"
+)
+
+var (
+	proxyPool     *ProxyPool
+	proxyPoolOnce sync.Once
+)
+
+// GetProxyPool 获取全局代理池，首次调用时按基础配置创建并启动健康检查
+func GetProxyPool() *ProxyPool {
+	proxyPoolOnce.Do(func() {
+		proxyPool = NewProxyPool(GetInstance().Proxy)
+	})
+	return proxyPool
+}
+
+// ProxyStats 单个代理的统计信息
+type ProxyStats struct {
+	Proxy               string    `json:"proxy"`
+	Weight              int       `json:"weight"`
+	Alive               bool      `json:"alive"`
+	Requests            int64     `json:"requests"`            // 经该代理发出的请求数
+	Failures            int64     `json:"failures"`            // 失败总数(含探测)
+	ConsecutiveFailures int       `json:"consecutiveFailures"` // 连续失败次数
+	Latency             int64     `json:"latency"`             // 最近一次成功的耗时(毫秒)
+	LastError           string    `json:"lastError"`
+	LastCheck           time.Time `json:"lastCheck"` // 最近一次探测时间
+}
+
+type poolProxy struct {
+	url           *url.URL
+	weight        int
+	currentWeight int // 平滑加权轮询的当前权重
+	stats         ProxyStats
+}
+
+// ProxyPool 代理池
+type ProxyPool struct {
+	mu          sync.Mutex
+	proxies     []*poolProxy
+	mode        string
+	counter     uint64
+	maxFailures int
+	interval    time.Duration
+	checkURL    string
+	timeout     time.Duration
+	client      *http.Client // 健康检查使用的客户端
+	stop        chan struct{}
+}
+
+// NewProxyPool 根据代理配置创建代理池
+func NewProxyPool(settings ProxySettings) *ProxyPool {
+	pool := &ProxyPool{}
+	pool.Update(settings)
+	return pool
+}
+
+// Update 按新的代理配置重建代理池，保留仍在池中的代理的统计信息
+func (pool *ProxyPool) Update(settings ProxySettings) {
+	timeout := time.Duration(settings.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	pool.mu.Lock()
+	old := make(map[string]*poolProxy, len(pool.proxies))
+	for _, proxy := range pool.proxies {
+		old[proxy.stats.Proxy] = proxy
+	}
+	pool.proxies = nil
+	for i, raw := range settings.ProxyPool {
+		u, err := ParseProxyURL(raw)
+		if err != nil {
+			// 地址中可能带有认证信息，只记录序号
+			logger.Warnf("忽略代理池中第 %d 个无效的代理地址", i+1)
+			continue
+		}
+		if u.User == nil && settings.Username != "" {
+			u.User = url.UserPassword(settings.Username, settings.Password)
+		}
+		weight := settings.ProxyWeights[raw]
+		if weight <= 0 {
+			weight = 1
+		}
+		// 统计信息与日志中使用隐藏密码后的地址
+		name := u.Redacted()
+		proxy, ok := old[name]
+		if !ok {
+			proxy = &poolProxy{stats: ProxyStats{Proxy: name, Alive: true}}
+		}
+		proxy.url, proxy.weight, proxy.stats.Weight = u, weight, weight
+		pool.proxies = append(pool.proxies, proxy)
+	}
+	pool.mode = settings.PoolMode
+	pool.maxFailures = settings.HealthCheck.MaxFailures
+	if pool.maxFailures <= 0 {
+		pool.maxFailures = 1
+	}
+	pool.interval = time.Duration(settings.HealthCheck.Interval) * time.Second
+	pool.checkURL = settings.HealthCheck.URL
+	// 超时不变时沿用健康检查客户端，否则关闭旧客户端的空闲连接
+	var oldClient *http.Client
+	if pool.client == nil || pool.timeout != timeout {
+		oldClient = pool.client
+		dialer := &net.Dialer{Timeout: timeout}
+		pool.client = &http.Client{Timeout: timeout, Transport: newTargetTransport(&http.Transport{}, dialer, timeout)}
+	}
+	pool.timeout = timeout
+	oldStop := pool.stop
+	pool.stop = nil
+	interval := pool.interval
+	if settings.Enabled && settings.Mode != "direct" && len(pool.proxies) > 0 && interval > 0 {
+		pool.stop = make(chan struct{})
+	}
+	stop := pool.stop
+	pool.mu.Unlock()
+
+	if oldStop != nil {
+		close(oldStop)
+	}
+	if oldClient != nil {
+		oldClient.CloseIdleConnections()
+	}
+	if stop != nil {
+		go pool.healthLoop(stop, interval)
+	}
+}
+
+// Len 代理池中的代理数量(含暂时移出的代理)
+func (pool *ProxyPool) Len() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.proxies)
+}
+
+// Next 按选择模式返回下一个可用代理，exclude 中的代理(以返回的代理地址表示)不参与选择
+// 全部代理都被移出时从未排除的代理中选择，避免代理池整体不可用
+func (pool *ProxyPool) Next(exclude []string) *url.URL {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var alive, rest []*poolProxy
+	for _, proxy := range pool.proxies {
+		if slices.Contains(exclude, proxy.url.String()) {
+			continue
+		}
+		if proxy.stats.Alive {
+			alive = append(alive, proxy)
+		} else {
+			rest = append(rest, proxy)
+		}
+	}
+	if len(alive) == 0 {
+		alive = rest
+	}
+	if len(alive) == 0 {
+		return nil
+	}
+
+	var selected *poolProxy
+	switch pool.mode {
+	case PoolRandom:
+		selected = alive[rand.Intn(len(alive))]
+	case PoolWeight:
+		// 平滑加权轮询，权重大的代理被更均匀地分散选中
+		total := 0
+		for _, proxy := range alive {
+			proxy.currentWeight += proxy.weight
+			total += proxy.weight
+			if selected == nil || proxy.currentWeight > selected.currentWeight {
+				selected = proxy
+			}
+		}
+		selected.currentWeight -= total
+	default:
+		selected = alive[pool.counter%uint64(len(alive))]
+		pool.counter++
+	}
+	selected.stats.Requests++
+	u := *selected.url
+	return &u
+}
+
+// ReportSuccess 记录经代理的请求成功
+func (pool *ProxyPool) ReportSuccess(proxy *url.URL, latency time.Duration) {
+	pool.update(proxy, func(p *poolProxy) {
+		p.stats.ConsecutiveFailures = 0
+		p.stats.Latency = latency.Milliseconds()
+		if !p.stats.Alive {
+			logger.Infof("代理 %s 恢复可用，重新加入代理池", p.stats.Proxy)
+		}
+		p.stats.Alive = true
+	})
+}
+
+// ReportFailure 记录经代理的请求失败，连续失败达到上限后移出代理池
+func (pool *ProxyPool) ReportFailure(proxy *url.URL, err error) {
+	pool.update(proxy, func(p *poolProxy) {
+		p.stats.Failures++
+		p.stats.ConsecutiveFailures++
+		p.stats.LastError = err.Error()
+		if p.stats.Alive && p.stats.ConsecutiveFailures >= pool.maxFailures {
+			p.stats.Alive = false
+			logger.Warnf("代理 %s 连续失败 %d 次，移出代理池: %v", p.stats.Proxy, p.stats.ConsecutiveFailures, err)
+		}
+	})
+}
+
+func (pool *ProxyPool) update(proxy *url.URL, fn func(p *poolProxy)) {
+	if proxy == nil {
+		return
+	}
+	key := proxy.String()
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, p := range pool.proxies {
+		if p.url.String() == key {
+			fn(p)
+			return
+		}
+	}
+}
+
+// Stats 返回全部代理的统计信息
+func (pool *ProxyPool) Stats() []ProxyStats {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	stats := make([]ProxyStats, len(pool.proxies))
+	for i, proxy := range pool.proxies {
+		stats[i] = proxy.stats
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Proxy < stats[j].Proxy })
+	return stats
+}
+
+// Stop 停止健康检查
+func (pool *ProxyPool) Stop() {
+	pool.mu.Lock()
+	stop := pool.stop
+	pool.stop = nil
+	pool.mu.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+}
+
+func (pool *ProxyPool) healthLoop(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pool.CheckAll()
+		}
+	}
+}
+
+// CheckAll 立即探测全部代理
+func (pool *ProxyPool) CheckAll() {
+	pool.mu.Lock()
+	proxies := make([]*url.URL, len(pool.proxies))
+	for i, proxy := range pool.proxies {
+		proxies[i] = proxy.url
+	}
+	pool.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proxy := range proxies {
+		wg.Add(1)
+		go func(proxy *url.URL) {
+			defer wg.Done()
+			start := time.Now()
+			err := pool.probe(proxy)
+			pool.update(proxy, func(p *poolProxy) { p.stats.LastCheck = time.Now() })
+			if err != nil {
+				pool.ReportFailure(proxy, err)
+				return
+			}
+			pool.ReportSuccess(proxy, time.Since(start))
+		}(proxy)
+	}
+	wg.Wait()
+}
+
+// probe 配置了探测地址时经代理访问该地址，否则只检查代理端口是否可连接
+func (pool *ProxyPool) probe(proxy *url.URL) error {
+	pool.mu.Lock()
+	client, checkURL, timeout := pool.client, pool.checkURL, pool.timeout
+	pool.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if checkURL == "" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddress(proxy))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	req, err := http.NewRequestWithContext(withProxy(ctx, proxy), http.MethodGet, checkURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("探测返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolSelection(t *testing.T) {
+	pool := NewProxyPool(ProxySettings{
+		ProxyPool:    []string{"http://a:1", "http://b:1", "http://c:1"},
+		PoolMode:     PoolWeight,
+		ProxyWeights: map[string]int{"http://a:1": 3},
+	})
+	counts := map[string]int{}
+	for i := 0; i < 50; i++ {
+		counts[pool.Next(nil).Host]++
+	}
+	if counts["a:1"] != 30 || counts["b:1"] != 10 || counts["c:1"] != 10 {
+		t.Fatalf("unexpected weighted distribution %v", counts)
+	}
+
+	pool.Update(ProxySettings{ProxyPool: []string{"http://a:1", "http://b:1"}, PoolMode: PoolRoundRobin})
+	if first, second := pool.Next(nil), pool.Next(nil); first.Host == second.Host {
+		t.Fatalf("round-robin returned %s twice", first.Host)
+	}
+	if proxy := pool.Next([]string{"http://a:1"}); proxy.Host != "b:1" {
+		t.Fatalf("excluded proxy selected: %s", proxy)
+	}
+}
+
+func TestProxyPoolHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	alive := "http://" + listener.Addr().String()
+	dead := "http://127.0.0.1:1"
+	pool := NewProxyPool(ProxySettings{
+		ProxyPool:   []string{alive, dead},
+		HealthCheck: ProxyHealthCheck{MaxFailures: 2},
+	})
+
+	deadURL, _ := ParseProxyURL(dead)
+	pool.ReportFailure(deadURL, errors.New("refused"))
+	pool.ReportFailure(deadURL, errors.New("refused"))
+	for i := 0; i < 4; i++ {
+		if proxy := pool.Next(nil); proxy.String() == dead {
+			t.Fatal("removed proxy selected")
+		}
+	}
+
+	// 探测后存活的代理保留，端口关闭的代理仍然移出
+	pool.CheckAll()
+	for _, stats := range pool.Stats() {
+		if stats.Alive != (stats.Proxy == alive) {
+			t.Fatalf("unexpected state %+v", stats)
+		}
+	}
+	pool.ReportSuccess(deadURL, 0)
+	if stats := pool.Stats(); !stats[0].Alive || !stats[1].Alive {
+		t.Fatalf("proxy not re-admitted: %+v", stats)
+	}
+}
+
+func TestProxyPoolRedactsCredentials(t *testing.T) {
+	settings := ProxySettings{ProxyPool: []string{"http://user:secret@a:1", "http://b:1"}, Username: "admin", Password: "hunter2"}
+	pool := NewProxyPool(settings)
+	pool.Next(nil)
+	pool.Update(settings)
+	requests := int64(0)
+	for _, stats := range pool.Stats() {
+		if strings.Contains(stats.Proxy, "secret") || strings.Contains(stats.Proxy, "hunter2") {
+			t.Fatalf("password exposed in stats: %s", stats.Proxy)
+		}
+		requests += stats.Requests
+	}
+	if requests != 1 {
+		t.Fatalf("stats not kept across update: %+v", pool.Stats())
+	}
+	if proxy := pool.Next(nil); proxy.User == nil {
+		t.Fatal("credentials dropped from proxy url")
+	}
+}
+
+func TestProxyPoolReusesHealthClient(t *testing.T) {
+	settings := ProxySettings{ProxyPool: []string{"http://a:1"}, Timeout: 5}
+	pool := NewProxyPool(settings)
+	client := pool.client
+	pool.Update(settings)
+	if pool.client != client {
+		t.Fatal("health check client replaced although the timeout is unchanged")
+	}
+	settings.Timeout = 7
+	pool.Update(settings)
+	if pool.client == client || pool.client.Timeout != 7*time.Second {
+		t.Fatalf("health check client not rebuilt for the new timeout: %v", pool.client.Timeout)
+	}
+}
@@ -0,0 +1,308 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// 按目标限速：令牌桶限制请求速率，信号量限制并发，429/503 的 Retry-After 暂停该目标的后续请求
+// 主机级限制来自基础配置，shell 级限制来自C2配置
+
+// maxRetryAfter Retry-After 的上限，避免目标返回过长的等待时间
+const maxRetryAfter = 10 * time.Minute
+
+// RateLimitSettings 限速配置，各项为0时不限制
+type RateLimitSettings struct {
+	Rate          float64 `yaml:"rate"`           // 每秒请求数
+	Burst         int     `yaml:"burst"`          // 令牌桶容量，未设置时为1
+	MaxConcurrent int     `yaml:"max_concurrent"` // 最大并发请求数
+	Spread        int     `yaml:"spread"`         // 批量操作(如批量检测shell)分散到的时间窗口(秒)
+}
+
+// IsZero 是否未设置任何限制
+func (s *RateLimitSettings) IsZero() bool {
+	return s == nil || (s.Rate <= 0 && s.MaxConcurrent <= 0)
+}
+
+// limit 单个目标(主机或shell)的限制状态
+type limit struct {
+	settings RateLimitSettings
+	sem      *semaphore.Weighted
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	blocked  time.Time // Retry-After 指定的恢复时间
+}
+
+func newLimit(settings RateLimitSettings) *limit {
+	l := &limit{settings: settings, last: time.Now()}
+	if settings.Burst <= 0 {
+		l.settings.Burst = 1
+	}
+	l.tokens = float64(l.settings.Burst)
+	if settings.MaxConcurrent > 0 {
+		l.sem = semaphore.NewWeighted(int64(settings.MaxConcurrent))
+	}
+	return l
+}
+
+// reserve 取出一个令牌，返回需要等待的时间
+func (l *limit) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	if now.Before(l.blocked) {
+		wait = l.blocked.Sub(now)
+	}
+	if l.settings.Rate <= 0 {
+		return wait
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.settings.Rate
+	if max := float64(l.settings.Burst); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens < 0 {
+		if need := time.Duration(-l.tokens / l.settings.Rate * float64(time.Second)); need > wait {
+			wait = need
+		}
+	}
+	return wait
+}
+
+// cancelReservation 归还未使用的令牌
+func (l *limit) cancelReservation() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.settings.Rate > 0 {
+		l.tokens++
+	}
+}
+
+func (l *limit) block(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.blocked) {
+		l.blocked = until
+	}
+}
+
+// RateLimiter 按目标维护限速状态
+type RateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]*limit
+}
+
+// NewRateLimiter 创建限速器
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{limits: make(map[string]*limit)}
+}
+
+// get 返回目标的限制状态，配置变化后重新创建
+func (r *RateLimiter) get(key string, settings RateLimitSettings) *limit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.limits[key]
+	if !ok || l.settings.Rate != settings.Rate || l.settings.MaxConcurrent != settings.MaxConcurrent ||
+		(settings.Burst > 0 && l.settings.Burst != settings.Burst) {
+		blocked := time.Time{}
+		if ok {
+			blocked = l.blocked
+		}
+		l = newLimit(settings)
+		l.blocked = blocked
+		r.limits[key] = l
+	}
+	return l
+}
+
+// Wait 等待各目标的令牌与并发名额，返回释放并发名额的函数
+func (r *RateLimiter) Wait(ctx context.Context, keys []string, settings []RateLimitSettings) (func(), error) {
+	var acquired []*limit
+	release := func() {
+		for _, l := range acquired {
+			l.sem.Release(1)
+		}
+	}
+	for i, key := range keys {
+		if settings[i].IsZero() && !r.isBlocked(key) {
+			continue
+		}
+		l := r.get(key, settings[i])
+		if wait := l.reserve(); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				l.cancelReservation()
+				release()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if l.sem != nil {
+			if err := l.sem.Acquire(ctx, 1); err != nil {
+				release()
+				return nil, err
+			}
+			acquired = append(acquired, l)
+		}
+	}
+	return release, nil
+}
+
+func (r *RateLimiter) isBlocked(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.limits[key]
+	if !ok {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.blocked)
+}
+
+// Block 暂停目标的请求直到 until
+func (r *RateLimiter) Block(key string, until time.Time) {
+	r.mu.Lock()
+	l, ok := r.limits[key]
+	if !ok {
+		l = newLimit(RateLimitSettings{})
+		r.limits[key] = l
+	}
+	r.mu.Unlock()
+	l.block(until)
+}
+
+// hostKey 请求目标主机的限速键
+func hostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "host:" + rawURL
+	}
+	return "host:" + u.Host
+}
+
+// ShellKey shell 作为请求目标时的键
+func ShellKey(shellID int64) string {
+	return fmt.Sprintf("shell:%d", shellID)
+}
+
+// ParseShellKey 从 ShellKey 生成的键中取出 shell ID
+func ParseShellKey(key string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(key, "shell:"), 10, 64)
+	if err != nil || !strings.HasPrefix(key, "shell:") {
+		return 0, false
+	}
+	return id, true
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头(秒数或HTTP日期)，无效时返回0
+func ParseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	}
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
+
+// Spread 将 n 个操作均匀分散到 window 内执行并等待全部完成，ctx 取消后不再启动新的操作
+func Spread(ctx context.Context, n int, window time.Duration, fn func(i int)) {
+	var wg sync.WaitGroup
+	var step time.Duration
+	if n > 1 {
+		step = window / time.Duration(n)
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 && step > 0 {
+			timer := time.NewTimer(step)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				wg.Wait()
+				return
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// hostRateLimit 返回主机的限速配置，host_rate_limits 中匹配的配置优先
+func (c *BasicConfig) hostRateLimit(host string) RateLimitSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for pattern, settings := range c.HostRateLimits {
+		if pattern != "" && matchHost(host, pattern) {
+			return settings
+		}
+	}
+	return c.RateLimit
+}
+
+// rateLimits 返回请求需要满足的限速键与配置：目标主机，以及请求指定的 Target
+func (engine *HttpEngine) rateLimits(req *HttpRequest) ([]string, []RateLimitSettings) {
+	host := ""
+	if u, err := url.Parse(req.URL); err == nil {
+		host = u.Hostname()
+	}
+	keys := []string{hostKey(req.URL)}
+	limits := []RateLimitSettings{GetInstance().hostRateLimit(host)}
+	if req.Target != "" {
+		keys = append(keys, req.Target)
+		var settings RateLimitSettings
+		if req.RateLimit != nil {
+			settings = *req.RateLimit
+		}
+		limits = append(limits, settings)
+	}
+	return keys, limits
+}
+
+// throttle 目标返回 429/503 且带有 Retry-After 时，在指定时间内暂停该目标的请求
+// 重试等待与后续请求都会等到暂停结束
+func (engine *HttpEngine) throttle(keys []string, resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	wait := ParseRetryAfter(resp.Header)
+	if wait <= 0 {
+		return
+	}
+	until := time.Now().Add(wait)
+	for _, key := range keys {
+		engine.limiter.Block(key, until)
+	}
+	engine.logger.Warnf("%s returned %d, pausing requests for %v", keys[0], resp.StatusCode, wait)
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := NewRateLimiter()
+	keys := []string{"host:a"}
+	settings := []RateLimitSettings{{Rate: 20, Burst: 2, MaxConcurrent: 1}}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		release, err := limiter.Wait(context.Background(), keys, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	// 突发2个，其余2个各等待 50ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("token bucket not enforced, elapsed %v", elapsed)
+	}
+
+	// 并发名额被占用时等待，上下文取消后返回
+	release, _ := limiter.Wait(context.Background(), keys, settings)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Wait(ctx, keys, settings); err == nil {
+		t.Fatal("expected concurrency limit to block")
+	}
+	release()
+
+	limiter.Block("host:b", time.Now().Add(100*time.Millisecond))
+	start = time.Now()
+	release, err := limiter.Wait(context.Background(), []string{"host:b"}, []RateLimitSettings{{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("blocked target not paused, elapsed %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "3")
+	if wait := ParseRetryAfter(header); wait != 3*time.Second {
+		t.Fatalf("unexpected wait %v", wait)
+	}
+	header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if wait := ParseRetryAfter(header); wait != maxRetryAfter {
+		t.Fatalf("retry-after not capped: %v", wait)
+	}
+	header.Set("Retry-After", "soon")
+	if wait := ParseRetryAfter(header); wait != 0 {
+		t.Fatalf("invalid value parsed as %v", wait)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	var starts [4]time.Time
+	begin := time.Now()
+	Spread(context.Background(), len(starts), 200*time.Millisecond, func(i int) { starts[i] = time.Now() })
+	if gap := starts[3].Sub(begin); gap < 140*time.Millisecond {
+		t.Fatalf("operations not spread, last started after %v", gap)
+	}
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// 流量缓存的保留策略：限制保存时间、条数与数据库大小，超出阈值的报文截断保存
+// 后台定期清理过期记录并 VACUUM 回收空间
+
+// TrafficCacheSettings 流量缓存配置
+type TrafficCacheSettings struct {
+	Enabled       bool `yaml:"enabled"`        // 是否记录流量
+	MaxAge        int  `yaml:"max_age"`        // 保留时间(小时)，0 表示不限制
+	MaxRows       int  `yaml:"max_rows"`       // 最多保留的条数，0 表示不限制
+	MaxSize       int  `yaml:"max_size"`       // 数据库最大体积(MB)，0 表示不限制
+	MaxBody       int  `yaml:"max_body"`       // 报文与明文超过该大小(KB)时截断保存，0 表示不截断
+	PruneInterval int  `yaml:"prune_interval"` // 清理间隔(分钟)，0 表示不自动清理
+}
+
+// trafficCache 返回流量缓存配置
+func (c *BasicConfig) trafficCache() TrafficCacheSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TrafficCache
+}
+
+// 按体积清理时每次删除的最旧记录比例
+const pruneSizeFraction = 10
+
+// truncate 超过 limit 字节时截断，返回是否截断
+func truncate(data []byte, limit int) ([]byte, bool) {
+	if limit <= 0 || len(data) <= limit {
+		return data, false
+	}
+	return data[:limit:limit], true
+}
+
+// PruneResult 一次清理的结果
+type PruneResult struct {
+	Deleted int64 `json:"deleted"` // 删除的记录数
+	Size    int64 `json:"size"`    // 清理后的数据库体积(字节)
+}
+
+// Prune 按保留策略删除流量记录，删除了记录时执行 VACUUM 回收空间
+func (cm *CacheManager) Prune(settings TrafficCacheSettings) (PruneResult, error) {
+	var result PruneResult
+	if settings.MaxAge > 0 {
+		before := time.Now().Add(-time.Duration(settings.MaxAge) * time.Hour)
+		deleted := cm.db.Where("created_at < ?", before).Delete(&HttpCache{})
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Deleted += deleted.RowsAffected
+	}
+	if settings.MaxRows > 0 {
+		var count int64
+		if err := cm.db.Model(&HttpCache{}).Count(&count).Error; err != nil {
+			return result, err
+		}
+		if excess := count - int64(settings.MaxRows); excess > 0 {
+			n, err := cm.deleteOldest(excess)
+			result.Deleted += n
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	if settings.MaxSize > 0 {
+		limit := int64(settings.MaxSize) << 20
+		for {
+			size, err := cm.dataSize()
+			if err != nil {
+				return result, err
+			}
+			if size <= limit {
+				break
+			}
+			var count int64
+			if err := cm.db.Model(&HttpCache{}).Count(&count).Error; err != nil {
+				return result, err
+			}
+			if count == 0 {
+				break
+			}
+			n, err := cm.deleteOldest(count/pruneSizeFraction + 1)
+			result.Deleted += n
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	if result.Deleted > 0 {
+		if err := cm.db.Exec("VACUUM").Error; err != nil {
+			return result, err
+		}
+	}
+	size, err := cm.fileSize()
+	result.Size = size
+	return result, err
+}
+
+// deleteOldest 删除最旧的 n 条记录
+func (cm *CacheManager) deleteOldest(n int64) (int64, error) {
+	oldest := cm.db.Model(&HttpCache{}).Select("id").Order("created_at, id").Limit(int(n))
+	deleted := cm.db.Where("id IN (?)", oldest).Delete(&HttpCache{})
+	return deleted.RowsAffected, deleted.Error
+}
+
+// dataSize 数据库中已使用页面的体积，删除记录后立即减小
+func (cm *CacheManager) dataSize() (int64, error) {
+	var size int64
+	err := cm.db.Raw("SELECT (page_count - freelist_count) * page_size FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()").Scan(&size).Error
+	return size, err
+}
+
+// fileSize 数据库文件的体积
+func (cm *CacheManager) fileSize() (int64, error) {
+	var size int64
+	err := cm.db.Raw("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size).Error
+	return size, err
+}
+
+// startPruning 按基础配置定期清理流量缓存，配置修改后下一次清理时生效
+func (cm *CacheManager) startPruning() {
+	stop := make(chan struct{})
+	cm.stopPrune = stop
+	go func() {
+		for {
+			settings := GetInstance().trafficCache()
+			interval := time.Duration(settings.PruneInterval) * time.Minute
+			if interval <= 0 {
+				interval = time.Minute // 未开启自动清理时定期检查配置
+			}
+			timer := time.NewTimer(interval)
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if settings.PruneInterval <= 0 {
+				continue
+			}
+			if result, err := cm.Prune(GetInstance().trafficCache()); err != nil {
+				logger.Warnf("清理流量缓存失败: %v", err)
+			} else if result.Deleted > 0 {
+				logger.Infof("已清理 %d 条流量记录，缓存大小 %d KB", result.Deleted, result.Size>>10)
+			}
+		}
+	}()
+}
+
+// cache 将本次发送的请求与响应交给缓存协程写入，resp 为空表示未收到响应
+// 队列已满时丢弃，避免请求阻塞或协程堆积
+func (engine *HttpEngine) cache(req *HttpRequest, resp *http.Response) {
+	if req.NoCache || !GetInstance().trafficCache().Enabled {
+		return
+	}
+	select {
+	case engine.cacheChan <- cacheEntry(req, resp):
+	default:
+		if dropped := atomic.AddInt64(&engine.droppedCache, 1); dropped&(dropped-1) == 0 {
+			engine.logger.Warnf("Traffic cache queue is full, %d requests not recorded", dropped)
+		}
+	}
+}
+
+// cacheEntry 复制要记录的字段，请求重试时会修改原请求的请求头与响应
+func cacheEntry(req *HttpRequest, resp *http.Response) *HttpRequest {
+	headers := make(map[string]string, len(req.Headers))
+	for key, value := range req.Headers {
+		headers[key] = value
+	}
+	entry := &HttpRequest{
+		ID:        req.ID,
+		Method:    req.Method,
+		URL:       req.URL,
+		Headers:   headers,
+		Body:      req.Body,
+		SessionID: req.SessionID,
+		ShellID:   req.ShellID,
+		Operation: req.Operation,
+		Plaintext: req.Plaintext,
+		Response:  &HttpResponse{},
+		started:   req.started,
+		duration:  req.duration,
+	}
+	if resp != nil {
+		entry.Response.code, entry.Response.Headers = resp.StatusCode, resp.Header
+		if req.Response != nil && req.Response.raw == resp {
+			entry.Response.Body = req.Response.Body
+		}
+	}
+	return entry
+}
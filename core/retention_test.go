@@ -0,0 +1,58 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	cache, err := NewCacheManager(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := GetInstance().trafficCache().MaxBody << 10
+	if limit <= 0 {
+		t.Skip("body truncation disabled")
+	}
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		req := NewHttpRequest()
+		req.Method, req.URL, req.Headers = "POST", "http://target/", map[string]string{}
+		req.Body = bytes.Repeat([]byte{'a'}, limit+i)
+		req.Plaintext = []byte{byte('a' + i)}
+		req.started = now.Add(time.Duration(i-4) * 24 * time.Hour)
+		req.Response = NewHttpResponse(200, nil, nil)
+		if err := cache.SaveToCache(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, _ := cache.QueryTraffic(TrafficQuery{})
+	record := page.Records[4]
+	if !record.Truncated || len(record.RequestBody) != limit || record.RequestSize != int64(limit+4) {
+		t.Fatalf("body not truncated: truncated=%v len=%d size=%d", record.Truncated, len(record.RequestBody), record.RequestSize)
+	}
+
+	// 保留两天内的记录(c、d、e)，再只保留最新的两条
+	result, err := cache.Prune(TrafficCacheSettings{MaxAge: 60, MaxRows: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 3 || result.Size == 0 {
+		t.Fatalf("unexpected prune result %+v", result)
+	}
+	page, _ = cache.QueryTraffic(TrafficQuery{})
+	got := ""
+	for _, record := range page.Records {
+		got += record.RequestPlaintext
+	}
+	if got != "de" {
+		t.Fatalf("got %q after prune, want %q", got, "de")
+	}
+
+	if result, err = cache.Prune(TrafficCacheSettings{}); err != nil || result.Deleted != 0 {
+		t.Fatalf("prune without limits deleted %d: %v", result.Deleted, err)
+	}
+}
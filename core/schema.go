@@ -0,0 +1,193 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSON Schema(draft 2020-12)生成，字段名取自 yaml 标签，供编辑器与UI校验配置
+
+// SchemaDraft 生成的 Schema 版本
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema JSON Schema 节点(仅包含用到的关键字)
+type Schema struct {
+	Draft                string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false 或 *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Examples             []interface{}      `json:"examples,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ReflectSchema 根据结构体的 yaml 标签生成 Schema
+// 未设置 yaml 标签或标签为 "-" 的字段视为运行时数据，不出现在 Schema 中
+func ReflectSchema(v interface{}) *Schema {
+	schema := reflectType(reflect.TypeOf(v))
+	schema.Draft = SchemaDraft
+	return schema
+}
+
+func reflectType(typ reflect.Type) *Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Description: "Base64"}
+		}
+		return &Schema{Type: "array", Items: reflectType(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: reflectType(typ.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			schema.Properties[name] = reflectType(field.Type)
+		}
+		return schema
+	}
+	return &Schema{}
+}
+
+// Property 按路径获取子节点，数组使用 "[]" 表示元素，如 Property("request", "condition", "[]", "type")
+func (s *Schema) Property(path ...string) *Schema {
+	node := s
+	for _, name := range path {
+		if node == nil {
+			return nil
+		}
+		if name == "[]" {
+			node = node.Items
+			continue
+		}
+		node = node.Properties[name]
+	}
+	return node
+}
+
+// Describe 设置路径上节点的说明，路径不存在时忽略
+func (s *Schema) Describe(description string, path ...string) *Schema {
+	if node := s.Property(path...); node != nil {
+		node.Description = description
+	}
+	return s
+}
+
+// SetEnum 设置路径上节点的可选值
+func (s *Schema) SetEnum(values []string, path ...string) *Schema {
+	if node := s.Property(path...); node != nil {
+		node.Enum = make([]interface{}, len(values))
+		for i, v := range values {
+			node.Enum[i] = v
+		}
+	}
+	return s
+}
+
+// SetRange 设置数值范围
+func (s *Schema) SetRange(min, max float64, path ...string) *Schema {
+	if node := s.Property(path...); node != nil {
+		node.Minimum, node.Maximum = &min, &max
+	}
+	return s
+}
+
+// SetOptionalRange 设置数值范围，同时允许 0 表示未设置
+func (s *Schema) SetOptionalRange(min, max float64, path ...string) *Schema {
+	if node := s.Property(path...); node != nil {
+		node.AnyOf = []*Schema{{Enum: []interface{}{0}}, {Minimum: &min, Maximum: &max}}
+	}
+	return s
+}
+
+// JSON 以缩进格式输出
+func (s *Schema) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// BasicConfigSchema 基础配置的 Schema
+func BasicConfigSchema() *Schema {
+	schema := ReflectSchema(BasicConfig{})
+	schema.Title = "caffeine basic config"
+	schema.SetEnum([]string{"direct", "proxy", "auto", "random"}, "proxy", "mode").
+		SetEnum([]string{PoolRoundRobin, PoolRandom, PoolWeight}, "proxy", "pool_mode").
+		Describe("代理权重，键为 proxy_pool 中的地址", "proxy", "proxy_weights").
+		SetRange(0, 86400, "proxy", "health_check", "interval").
+		Describe("代理池，代理地址格式为 scheme://[user:pass@]host:port", "proxy", "proxy_pool").
+		Describe("SOCKS代理地址，未带协议时按 socks_ver 选择 socks4/socks5", "proxy", "socks_proxy").
+		Describe("不使用代理的地址，支持 *.example.com", "proxy", "no_proxy").
+		Describe("强制使用代理的地址，支持 *.example.com", "proxy", "use_proxy").
+		Describe("C2配置目录", "profile_dir").
+		Describe("未绑定配置的shell使用的配置名称", "default_profile").
+		Describe("本地密钥库目录", "key_store_dir")
+	if node := schema.Property("proxy", "socks_ver"); node != nil {
+		node.Enum = []interface{}{4, 5}
+	}
+	for _, name := range []string{"dial", "read", "write", "keepalive"} {
+		schema.SetRange(0, 3600, "timeout", name).Describe("秒", "timeout", name)
+	}
+	schema.SetRange(0, 1000, "circuit_breaker", "threshold").
+		Describe("连续失败次数达到后熔断，0 表示不熔断", "circuit_breaker", "threshold").
+		SetRange(0, 86400, "circuit_breaker", "cooldown").
+		Describe("熔断后多久(秒)放行一个探测请求", "circuit_breaker", "cooldown")
+	schema.Describe("是否记录请求与响应到流量缓存", "traffic_cache", "enabled").
+		SetRange(0, 87600, "traffic_cache", "max_age").Describe("保留时间(小时)，0 表示不限制", "traffic_cache", "max_age").
+		SetRange(0, 100000000, "traffic_cache", "max_rows").Describe("最多保留的条数，0 表示不限制", "traffic_cache", "max_rows").
+		SetRange(0, 1048576, "traffic_cache", "max_size").Describe("数据库最大体积(MB)，0 表示不限制", "traffic_cache", "max_size").
+		SetRange(0, 1048576, "traffic_cache", "max_body").Describe("报文与明文超过该大小(KB)时截断保存，0 表示不截断", "traffic_cache", "max_body").
+		SetRange(0, 10080, "traffic_cache", "prune_interval").Describe("清理间隔(分钟)，0 表示不自动清理", "traffic_cache", "prune_interval")
+	if node := schema.Property("metrics", "listen"); node != nil {
+		node.Description = "Prometheus 指标导出地址，只允许本机地址，如 127.0.0.1:9464，为空时不导出"
+		node.Examples = []interface{}{"127.0.0.1:9464"}
+	}
+	DescribeRateLimit(schema.Property("rate_limit"))
+	if node := schema.Property("host_rate_limits"); node != nil {
+		if limit, ok := node.AdditionalProperties.(*Schema); ok {
+			DescribeRateLimit(limit)
+		}
+	}
+	return schema
+}
+
+// DescribeRateLimit 设置限速配置节点的范围与说明
+func DescribeRateLimit(node *Schema) {
+	if node == nil {
+		return
+	}
+	node.SetRange(0, 10000, "rate").Describe("每秒请求数，0 表示不限制", "rate").
+		SetRange(0, 10000, "burst").Describe("允许的突发请求数，未设置时为1", "burst").
+		SetRange(0, 10000, "max_concurrent").Describe("最大并发请求数，0 表示不限制", "max_concurrent").
+		SetRange(0, 3600, "spread").Describe("批量操作分散执行的时间窗口(秒)", "spread")
+}
@@ -16,6 +16,9 @@ type Operate struct {
 type Target struct {
 	ID       int64
 	ShellURL string
+	Password string      // shell 密码，即载荷所在的表单/查询字段名
+	TLS      TLSSettings // shell 单独的TLS配置，覆盖C2配置中的同名设置
+	NoCache  bool        // 不记录该shell的流量
 }
 
 // webshell session
@@ -29,6 +32,8 @@ type Session struct {
 	Info           *SystemInfo       //系统信息
 	FileSystem     *FileSystemCache  //文件目录缓存
 	Environment    map[string]string // 存储环境变量或其他上下文数据
+	SessionKey     []byte            // 协商得到的会话密钥，为空时使用配置中的静态密钥
+	SessionToken   string            // 服务端保存会话密钥的会话标识
 }
 
 // AddOperateHistory  添加操作记录
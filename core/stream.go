@@ -0,0 +1,140 @@
+package core
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// 流式加解密，与 coding.go 中的同名算法输出一致，内存占用与数据大小无关
+
+// xorStream 按数据位置循环使用密钥，与 XorCrypto 保持一致
+type xorStream struct {
+	key []byte
+	pos int
+}
+
+func (x *xorStream) apply(dst, src []byte) {
+	for i := range src {
+		dst[i] = src[i] ^ x.key[x.pos%len(x.key)]
+		x.pos++
+	}
+}
+
+type xorWriter struct {
+	xorStream
+	w   io.Writer
+	buf []byte
+}
+
+// NewXorWriter 写入时进行异或
+func NewXorWriter(w io.Writer, key []byte) io.Writer {
+	return &xorWriter{xorStream: xorStream{key: key}, w: w}
+}
+
+func (x *xorWriter) Write(p []byte) (int, error) {
+	if cap(x.buf) < len(p) {
+		x.buf = make([]byte, len(p))
+	}
+	buf := x.buf[:len(p)]
+	x.apply(buf, p)
+	return x.w.Write(buf)
+}
+
+type xorReader struct {
+	xorStream
+	r io.Reader
+}
+
+// NewXorReader 读取时进行异或
+func NewXorReader(r io.Reader, key []byte) io.Reader {
+	return &xorReader{xorStream: xorStream{key: key}, r: r}
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	x.apply(p[:n], p[:n])
+	return n, err
+}
+
+// NewAESEncryptWriter AES-CFB 加密写入，先写出随机IV，格式与 AESEncode 一致
+func NewAESEncryptWriter(w io.Writer, key []byte) (io.Writer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(iv); err != nil {
+		return nil, err
+	}
+	return &cipher.StreamWriter{S: cipher.NewCFBEncrypter(block, iv), W: w}, nil
+}
+
+// aesDecryptReader 首次读取时取出IV
+type aesDecryptReader struct {
+	block  cipher.Block
+	r      io.Reader
+	stream io.Reader
+}
+
+// NewAESDecryptReader AES-CFB 解密读取，与 AESDecode 一致
+func NewAESDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesDecryptReader{block: block, r: r}, nil
+}
+
+func (a *aesDecryptReader) Read(p []byte) (int, error) {
+	if a.stream == nil {
+		iv := make([]byte, aes.BlockSize)
+		if _, err := io.ReadFull(a.r, iv); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return 0, errors.New("ciphertext too short")
+			}
+			return 0, err
+		}
+		a.stream = &cipher.StreamReader{S: cipher.NewCFBDecrypter(a.block, iv), R: a.r}
+	}
+	return a.stream.Read(p)
+}
+
+// NewGzipWriter gzip流式压缩，Close 时写出尾部
+func NewGzipWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// NewGzipReader gzip流式解压
+func NewGzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// NewDeflateWriter 原始deflate流式压缩
+func NewDeflateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression) // 默认压缩级别不会出错
+	return fw
+}
+
+// NewDeflateReader 原始deflate流式解压
+func NewDeflateReader(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+// NewZlibWriter zlib流式压缩
+func NewZlibWriter(w io.Writer) io.WriteCloser {
+	return zlib.NewWriter(w)
+}
+
+// NewZlibReader zlib流式解压
+func NewZlibReader(r io.Reader) (io.Reader, error) {
+	return zlib.NewReader(r)
+}
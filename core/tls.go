@@ -0,0 +1,139 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSSettings 目标的TLS配置，可在C2配置与单个shell上设置
+type TLSSettings struct {
+	CAFile             string   `yaml:"ca_file" json:"ca_file"`                           // CA证书(PEM)，为空时使用系统根证书
+	CertFile           string   `yaml:"cert_file" json:"cert_file"`                       // 客户端证书(PEM)，用于双向TLS
+	KeyFile            string   `yaml:"key_file" json:"key_file"`                         // 客户端私钥(PEM)
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify" json:"insecure_skip_verify"` // 不校验服务端证书
+	ServerName         string   `yaml:"server_name" json:"server_name"`                   // 覆盖SNI与证书校验使用的主机名
+	MinVersion         string   `yaml:"min_version" json:"min_version"`                   // 最低TLS版本 1.0/1.1/1.2/1.3
+	PinSHA256          []string `yaml:"pin_sha256" json:"pin_sha256"`                     // 服务端证书SHA-256指纹，任一匹配即可
+}
+
+// TLSVersions 支持的最低TLS版本
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// IsZero 是否未做任何设置
+func (s *TLSSettings) IsZero() bool {
+	return s == nil || (s.CAFile == "" && s.CertFile == "" && s.KeyFile == "" && !s.InsecureSkipVerify &&
+		s.ServerName == "" && s.MinVersion == "" && len(s.PinSHA256) == 0)
+}
+
+// Merge 返回以 override 中已设置的字段覆盖后的配置，shell 的设置覆盖C2配置
+func (s TLSSettings) Merge(override TLSSettings) TLSSettings {
+	if override.CAFile != "" {
+		s.CAFile = override.CAFile
+	}
+	if override.CertFile != "" || override.KeyFile != "" {
+		s.CertFile, s.KeyFile = override.CertFile, override.KeyFile
+	}
+	if override.InsecureSkipVerify {
+		s.InsecureSkipVerify = true
+	}
+	if override.ServerName != "" {
+		s.ServerName = override.ServerName
+	}
+	if override.MinVersion != "" {
+		s.MinVersion = override.MinVersion
+	}
+	if len(override.PinSHA256) > 0 {
+		s.PinSHA256 = override.PinSHA256
+	}
+	return s
+}
+
+// key 作为 Transport 缓存的键
+func (s *TLSSettings) key() string {
+	return fmt.Sprintf("%q|%q|%q|%t|%q|%q|%q", s.CAFile, s.CertFile, s.KeyFile, s.InsecureSkipVerify,
+		s.ServerName, s.MinVersion, strings.Join(s.PinSHA256, ","))
+}
+
+// Validate 检查配置是否完整，不读取文件
+func (s *TLSSettings) Validate() error {
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return fmt.Errorf("cert_file 与 key_file 需要同时设置")
+	}
+	if _, ok := TLSVersions[s.MinVersion]; s.MinVersion != "" && !ok {
+		return fmt.Errorf("无效的TLS版本: %s", s.MinVersion)
+	}
+	for _, pin := range s.PinSHA256 {
+		if _, err := parseFingerprint(pin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config 根据配置生成 tls.Config
+func (s *TLSSettings) Config() (*tls.Config, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		InsecureSkipVerify: s.InsecureSkipVerify,
+		ServerName:         s.ServerName,
+		MinVersion:         TLSVersions[s.MinVersion],
+	}
+	if s.CAFile != "" {
+		data, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA证书中没有有效的PEM证书: %s", s.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if s.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(s.PinSHA256) > 0 {
+		pins := make(map[string]bool, len(s.PinSHA256))
+		for _, pin := range s.PinSHA256 {
+			fingerprint, _ := parseFingerprint(pin)
+			pins[fingerprint] = true
+		}
+		// 跳过证书校验时同样检查指纹
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("服务端未提供证书")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if fingerprint := hex.EncodeToString(sum[:]); !pins[fingerprint] {
+				return fmt.Errorf("服务端证书指纹不匹配: %s", fingerprint)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// parseFingerprint 规范化SHA-256指纹，允许大写与冒号分隔
+func parseFingerprint(pin string) (string, error) {
+	fingerprint := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(pin), ":", ""))
+	if raw, err := hex.DecodeString(fingerprint); err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("无效的证书指纹: %s", pin)
+	}
+	return fingerprint, nil
+}
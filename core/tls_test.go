@@ -0,0 +1,48 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	sum := sha256.Sum256(server.Certificate().Raw)
+
+	get := func(settings TLSSettings) error {
+		config, err := settings.Config()
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(TLSSettings{InsecureSkipVerify: true, PinSHA256: []string{hex.EncodeToString(sum[:])}}); err != nil {
+		t.Fatalf("pinned certificate rejected: %v", err)
+	}
+	if err := get(TLSSettings{InsecureSkipVerify: true, PinSHA256: []string{hex.EncodeToString(make([]byte, 32))}}); err == nil {
+		t.Fatal("mismatched pin accepted")
+	}
+	if err := get(TLSSettings{}); err == nil {
+		t.Fatal("self-signed certificate accepted without CA")
+	}
+}
+
+func TestTLSSettingsMerge(t *testing.T) {
+	profile := TLSSettings{CAFile: "ca.pem", MinVersion: "1.2"}
+	merged := profile.Merge(TLSSettings{MinVersion: "1.3", ServerName: "internal"})
+	if merged.CAFile != "ca.pem" || merged.MinVersion != "1.3" || merged.ServerName != "internal" {
+		t.Fatalf("unexpected merge result %+v", merged)
+	}
+	if err := (&TLSSettings{CertFile: "client.pem"}).Validate(); err == nil {
+		t.Fatal("cert without key accepted")
+	}
+}
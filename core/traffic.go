@@ -0,0 +1,136 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 流量查询：按会话、shell、操作、时间与状态码查询缓存的请求，
+// 返回编码后的原始报文与编码前/解码后的明文，无需重新发送即可排查出错的交互
+
+// TrafficQuery 流量查询条件，零值表示不限制
+type TrafficQuery struct {
+	SessionID int64     `json:"sessionId"`
+	ShellID   int64     `json:"shellId"`
+	Operation string    `json:"operation"` // 发出请求的操作，如 RunCmd
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+	Status    int       `json:"status"` // 响应状态码
+	Failed    bool      `json:"failed"` // 只查询状态码 >= 400 的请求
+	Limit     int       `json:"limit"`  // 返回的最大条数，0 表示不限制
+	Offset    int       `json:"offset"`
+}
+
+// TrafficRecord 一次缓存的请求与响应
+type TrafficRecord struct {
+	ID                int64             `json:"id"`
+	RequestID         int64             `json:"requestId"`
+	SessionID         int64             `json:"sessionId"`
+	ShellID           int64             `json:"shellId"`
+	Operation         string            `json:"operation"`
+	Method            string            `json:"method"`
+	URL               string            `json:"url"`
+	Status            int               `json:"status"`
+	Duration          int64             `json:"duration"`     // 毫秒
+	RequestSize       int64             `json:"requestSize"`  // 请求体原始大小
+	ResponseSize      int64             `json:"responseSize"` // 响应体原始大小
+	Truncated         bool              `json:"truncated"`    // 报文或明文是否被截断保存
+	CreatedAt         time.Time         `json:"createdAt"`
+	RequestHeaders    map[string]string `json:"requestHeaders"`
+	RequestBody       []byte            `json:"requestBody"`
+	RequestPlaintext  string            `json:"requestPlaintext"` // 非 UTF-8 时以 base64: 开头
+	ResponseHeaders   http.Header       `json:"responseHeaders"`
+	ResponseBody      []byte            `json:"responseBody"`
+	ResponsePlaintext string            `json:"responsePlaintext"` // 非 UTF-8 时以 base64: 开头
+}
+
+// TrafficPage 分页查询结果
+type TrafficPage struct {
+	Total   int64           `json:"total"` // 符合条件的总条数
+	Records []TrafficRecord `json:"records"`
+}
+
+// Record 转换为查询结果
+func (c *HttpCache) Record() TrafficRecord {
+	record := TrafficRecord{
+		ID:                c.ID,
+		RequestID:         c.RequestID,
+		SessionID:         c.SessionID,
+		ShellID:           c.ShellID,
+		Operation:         c.Operation,
+		Method:            c.Method,
+		URL:               c.URL,
+		Status:            c.RespCode,
+		Duration:          c.Duration,
+		RequestSize:       c.ReqSize,
+		ResponseSize:      c.RespSize,
+		Truncated:         c.Truncated,
+		CreatedAt:         c.CreatedAt,
+		RequestBody:       c.ReqBody,
+		RequestPlaintext:  displayText(c.ReqPlain),
+		ResponseBody:      c.RespBody,
+		ResponsePlaintext: displayText(c.RespPlain),
+	}
+	json.Unmarshal(c.ReqHeader, &record.RequestHeaders)
+	json.Unmarshal(c.RespHeader, &record.ResponseHeaders)
+	return record
+}
+
+// where 按查询条件筛选，不包含分页
+func (q TrafficQuery) where(db *gorm.DB) *gorm.DB {
+	if q.SessionID != 0 {
+		db = db.Where("session_id = ?", q.SessionID)
+	}
+	if q.ShellID != 0 {
+		db = db.Where("shell_id = ?", q.ShellID)
+	}
+	if q.Operation != "" {
+		db = db.Where("operation = ?", q.Operation)
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		db = db.Where("created_at <= ?", q.Until)
+	}
+	if q.Status != 0 {
+		db = db.Where("resp_code = ?", q.Status)
+	}
+	if q.Failed {
+		db = db.Where("resp_code >= ?", 400)
+	}
+	return db
+}
+
+// QueryTraffic 按条件查询缓存的流量，按时间先后排序
+func (cm *CacheManager) QueryTraffic(q TrafficQuery) (*TrafficPage, error) {
+	page := &TrafficPage{Records: make([]TrafficRecord, 0)}
+	if err := q.where(cm.db.Model(&HttpCache{})).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	query := q.where(cm.db.Model(&HttpCache{})).Order("created_at, id").Offset(q.Offset)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var rows []HttpCache
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		page.Records = append(page.Records, rows[i].Record())
+	}
+	return page, nil
+}
+
+// GetTraffic 按缓存记录ID获取一次请求
+func (cm *CacheManager) GetTraffic(id int64) (*TrafficRecord, error) {
+	var row HttpCache
+	if err := cm.db.First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	record := row.Record()
+	return &record, nil
+}
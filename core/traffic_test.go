@@ -0,0 +1,110 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryTraffic(t *testing.T) {
+	cache, err := NewCacheManager(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	exchanges := []struct {
+		shell     int64
+		operation string
+		code      int
+	}{
+		{1, "RunCmd", 200},
+		{1, "LoadDir", 500},
+		{2, "RunCmd", 200},
+		{1, "RunCmd", 404},
+	}
+	for i, exchange := range exchanges {
+		req := NewHttpRequest()
+		req.Method, req.URL, req.Headers = "POST", "http://target/", map[string]string{}
+		req.SessionID, req.ShellID, req.Operation = 10+exchange.shell, exchange.shell, exchange.operation
+		req.Plaintext = []byte{byte('a' + i)}
+		req.started = start.Add(time.Duration(i) * time.Minute)
+		req.Response = NewHttpResponse(exchange.code, nil, nil)
+		if err := cache.SaveToCache(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		query TrafficQuery
+		want  string // 按顺序返回的请求明文
+	}{
+		{TrafficQuery{ShellID: 1}, "abd"},
+		{TrafficQuery{ShellID: 1, Operation: "RunCmd"}, "ad"},
+		{TrafficQuery{SessionID: 12}, "c"},
+		{TrafficQuery{Failed: true}, "bd"},
+		{TrafficQuery{Status: 500}, "b"},
+		{TrafficQuery{Since: start.Add(90 * time.Second)}, "cd"},
+		{TrafficQuery{Limit: 2, Offset: 1}, "bc"},
+		{TrafficQuery{Offset: 3}, "d"},
+	}
+	for _, c := range cases {
+		page, err := cache.QueryTraffic(c.query)
+		if err != nil {
+			t.Fatalf("%+v: %v", c.query, err)
+		}
+		got := ""
+		for _, record := range page.Records {
+			got += record.RequestPlaintext
+		}
+		if got != c.want {
+			t.Errorf("%+v: got %q, want %q", c.query, got, c.want)
+		}
+	}
+
+	page, _ := cache.QueryTraffic(TrafficQuery{Limit: 1})
+	if page.Total != 4 || len(page.Records) != 1 {
+		t.Fatalf("unexpected page total %d with %d records", page.Total, len(page.Records))
+	}
+	record, err := cache.GetTraffic(page.Records[0].ID)
+	if err != nil || record.Operation != "RunCmd" || record.ShellID != 1 {
+		t.Fatalf("unexpected record %+v: %v", record, err)
+	}
+}
+
+func TestTrafficRecordsFailedExchange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "stack trace")
+	}))
+	defer server.Close()
+	cache, err := NewCacheManager(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewHttpEngine(&HttpEngineConfig{MaxConns: 2, PoolSize: 1, Timeout: 5 * time.Second})
+	engine.cacheManager = cache
+
+	req := NewHttpRequest()
+	req.Method, req.URL, req.Headers = "POST", server.URL, map[string]string{}
+	req.ShellID, req.Operation, req.Plaintext = 3, "RunCmd", []byte("whoami")
+	if err := engine.ExecuteRequest(req); err == nil {
+		t.Fatal("expected an error for status 500")
+	}
+
+	var page *TrafficPage
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if page, err = cache.QueryTraffic(TrafficQuery{Failed: true}); err == nil && page.Total > 0 {
+			break
+		}
+	}
+	if page == nil || page.Total != 1 {
+		t.Fatalf("failed exchange not recorded: %+v %v", page, err)
+	}
+	record := page.Records[0]
+	if record.Status != 500 || string(record.ResponseBody) != "stack trace" || record.RequestPlaintext != "whoami" || record.ShellID != 3 {
+		t.Fatalf("unexpected record %+v", record)
+	}
+}
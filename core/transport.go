@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetTransport 按请求上下文中的代理与TLS配置分发请求
+// 每种组合使用独立的 Transport，连接池互不影响
+type targetTransport struct {
+	base       *http.Transport // 直连且使用默认TLS配置
+	dialer     *net.Dialer
+	timeout    time.Duration // SOCKS握手超时
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+	tlsConfigs map[string]*tls.Config
+}
+
+type tlsContextKey struct{}
+
+// withTLS 将请求使用的TLS配置放入上下文
+func withTLS(ctx context.Context, settings *TLSSettings) context.Context {
+	return context.WithValue(ctx, tlsContextKey{}, settings)
+}
+
+func tlsFromContext(ctx context.Context) *TLSSettings {
+	settings, _ := ctx.Value(tlsContextKey{}).(*TLSSettings)
+	return settings
+}
+
+func newTargetTransport(base *http.Transport, dialer *net.Dialer, timeout time.Duration) *targetTransport {
+	base.Proxy = nil
+	base.DialContext = dialer.DialContext
+	return &targetTransport{
+		base:       base,
+		dialer:     dialer,
+		timeout:    timeout,
+		transports: make(map[string]*http.Transport),
+		tlsConfigs: make(map[string]*tls.Config),
+	}
+}
+
+func (p *targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t, err := p.transport(proxyFromContext(req.Context()), tlsFromContext(req.Context()))
+	if err != nil {
+		return nil, err
+	}
+	return t.RoundTrip(req)
+}
+
+// tlsConfig 返回TLS配置对应的 tls.Config，证书文件只在首次使用时读取
+func (p *targetTransport) tlsConfig(settings *TLSSettings) (*tls.Config, error) {
+	if settings.IsZero() {
+		return nil, nil
+	}
+	key := settings.key()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if config, ok := p.tlsConfigs[key]; ok {
+		return config, nil
+	}
+	config, err := settings.Config()
+	if err != nil {
+		return nil, err
+	}
+	p.tlsConfigs[key] = config
+	return config, nil
+}
+
+// transport 返回代理与TLS配置对应的 Transport，首次使用时从直连 Transport 复制
+func (p *targetTransport) transport(proxy *url.URL, settings *TLSSettings) (*http.Transport, error) {
+	if proxy == nil && settings.IsZero() {
+		return p.base, nil
+	}
+	config, err := p.tlsConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if proxy != nil {
+		key = proxy.String()
+	}
+	if config != nil {
+		key += "|" + settings.key()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.transports[key]; ok {
+		return t, nil
+	}
+	t := p.base.Clone()
+	if proxy != nil {
+		if strings.HasPrefix(proxy.Scheme, "socks") {
+			t.DialContext = (&socksDialer{proxy: proxy, dialer: p.dialer, timeout: p.timeout}).DialContext
+		} else {
+			t.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	if config != nil {
+		t.TLSClientConfig = config
+	}
+	p.transports[key] = t
+	return t, nil
+}
+
+// configure 修改全部 Transport 的设置
+func (p *targetTransport) configure(fn func(t *http.Transport)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p.base)
+	for _, t := range p.transports {
+		fn(t)
+	}
+}
+
+func (p *targetTransport) CloseIdleConnections() {
+	p.configure(func(t *http.Transport) { t.CloseIdleConnections() })
+}
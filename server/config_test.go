@@ -10,7 +10,7 @@ import (
 
 func TestName(t *testing.T) {
 
-	data, err := ioutil.ReadFile("c2.yaml")
+	data, err := ioutil.ReadFile("../profiles/c2.yaml")
 	if err != nil {
 		fmt.Errorf("无法读取文件: %v", err)
 	}
